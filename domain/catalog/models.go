@@ -0,0 +1,80 @@
+package catalog
+
+import (
+	"time"
+
+	"github.com/downing/media-manager/domain/images"
+)
+
+const (
+	KindImport       = "import"
+	KindRawBackup    = "raw_backup"
+	KindEditedBackup = "edited_backup"
+	KindUpload       = "upload"
+)
+
+// Entry is everything the catalog knows about one source file.
+type Entry struct {
+	SourcePath   string        `json:"source_path"`
+	Size         int64         `json:"size"`
+	ModTime      time.Time     `json:"mod_time"`
+	Checksum     string        `json:"checksum"`
+	Timestamp    time.Time     `json:"timestamp"`
+	CameraModel  string        `json:"camera_model"`
+	Destinations []Destination `json:"destinations"`
+	// TimestampSource is where Timestamp came from, "" when no source had a
+	// usable time and the file was quarantined.
+	TimestampSource string `json:"timestamp_source,omitempty"`
+	// ClockOffset is the camera clock correction included in Timestamp.
+	ClockOffset time.Duration `json:"clock_offset,omitempty"`
+	// Metadata is what a photo records about how it was taken, nil for videos.
+	Metadata *images.Metadata `json:"metadata,omitempty"`
+}
+
+// Destination is one place a source file was copied, moved or uploaded to.
+type Destination struct {
+	Kind string `json:"kind"`
+	// Action is how the file got to Path, such as copy or move, "" when it
+	// was already there.
+	Action     string    `json:"action,omitempty"`
+	Path       string    `json:"path"`
+	Checksum   string    `json:"checksum"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// FileHash is the content checksum of a file in one of the media trees, kept
+// so unchanged files do not need hashing again.
+type FileHash struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Checksum string    `json:"checksum"`
+}
+
+// JournalEntry is a transfer of one group of files that has started but has
+// not been recorded yet, kept so a run that is interrupted can be finished or
+// rolled back by the next one.
+type JournalEntry struct {
+	Operation string        `json:"operation"`
+	Action    string        `json:"action"`
+	RootPath  string        `json:"root_path"`
+	Files     []JournalFile `json:"files"`
+	StartedAt time.Time     `json:"started_at"`
+}
+
+// Volume is a source volume, such as a memory card, that watch mode imported.
+// Signature describes the files on it after the import, so the volume is not
+// imported again until they change.
+type Volume struct {
+	ID         string    `json:"id"`
+	Path       string    `json:"path"`
+	Signature  string    `json:"signature"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// JournalFile is one file of a journaled transfer. Entry is its catalog entry
+// as it is before the destination is added.
+type JournalFile struct {
+	Entry       Entry  `json:"entry"`
+	Destination string `json:"destination"`
+}
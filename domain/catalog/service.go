@@ -0,0 +1,473 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInUse is returned by Open when another process has the catalog open.
+var ErrInUse = errors.New("catalog is in use by another run")
+
+const (
+	// readOnlyTimeout is how long a reader waits for a run that has the
+	// catalog open before reading a copy of it.
+	readOnlyTimeout = 500 * time.Millisecond
+	// snapshotAttempts bounds the copies taken of a catalog being written.
+	snapshotAttempts = 3
+)
+
+var (
+	entriesBucket = []byte("entries")
+	hashesBucket  = []byte("hashes")
+	journalBucket = []byte("journal")
+	volumesBucket = []byte("volumes")
+)
+
+type Service struct {
+	db *bolt.DB
+	// tempDir holds an empty catalog opened in place of a missing one, removed on Close.
+	tempDir string
+}
+
+// Open opens the catalog database at path, creating it if it does not exist.
+func Open(path string) (*Service, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("failed to open catalog %s: %w", path, ErrInUse)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalog %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{entriesBucket, hashesBucket, journalBucket, volumesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return rekeyEntries(tx.Bucket(entriesBucket))
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise catalog %s: %w", path, err)
+	}
+
+	return &Service{
+		db: db,
+	}, nil
+}
+
+// OpenReadOnly opens the catalog database at path without writing to it, for
+// runs that only read or plan. A catalog that does not exist yet is read as
+// empty and is not created. While another run has the catalog open, a copy of
+// it is read instead, as it was when the copy was taken.
+func OpenReadOnly(path string) (*Service, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		dir, err := os.MkdirTemp("", "media-manager-catalog-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create empty catalog for %s: %w", path, err)
+		}
+		s, err := Open(filepath.Join(dir, "catalog.db"))
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		s.tempDir = dir
+		return s, nil
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: readOnlyTimeout, ReadOnly: true})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return openSnapshot(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalog %s: %w", path, err)
+	}
+	return &Service{
+		db: db,
+	}, nil
+}
+
+// openSnapshot copies the catalog another run has open and opens the copy.
+// The copy is checked for consistency, as it may have been taken in the
+// middle of a write, and taken again when it is not.
+func openSnapshot(path string) (*Service, error) {
+	dir, err := os.MkdirTemp("", "media-manager-catalog-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create copy of catalog %s: %w", path, err)
+	}
+	copyPath := filepath.Join(dir, "catalog.db")
+
+	for range snapshotAttempts {
+		if err = copyFile(path, copyPath); err != nil {
+			break
+		}
+		var db *bolt.DB
+		db, err = bolt.Open(copyPath, 0644, &bolt.Options{Timeout: readOnlyTimeout, ReadOnly: true})
+		if err != nil {
+			continue
+		}
+		err = db.View(func(tx *bolt.Tx) error {
+			for err := range tx.Check() {
+				return err
+			}
+			return nil
+		})
+		if err == nil {
+			return &Service{db: db, tempDir: dir}, nil
+		}
+		db.Close()
+	}
+	os.RemoveAll(dir)
+	return nil, fmt.Errorf("failed to read catalog %s while it is in use: %w", path, err)
+}
+
+func copyFile(sourcePath, destPath string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dest, source); err != nil {
+		dest.Close()
+		return err
+	}
+	return dest.Close()
+}
+
+func (s *Service) Close() error {
+	err := s.db.Close()
+	if s.tempDir != "" {
+		os.RemoveAll(s.tempDir)
+	}
+	return err
+}
+
+// get returns the value of key in the bucket, or nil if either is missing, as
+// a catalog opened read only may predate some of the buckets.
+func get(tx *bolt.Tx, bucket, key []byte) []byte {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	return b.Get(key)
+}
+
+// forEach calls fn for every key and value in the bucket, if it exists.
+func forEach(tx *bolt.Tx, bucket []byte, fn func(k, v []byte) error) error {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(fn)
+}
+
+// rekeyEntries moves entries stored under their source path alone, as older
+// catalogs keep them, to the key of their source path, size and modification time.
+func rekeyEntries(bucket *bolt.Bucket) error {
+	entries := map[string]Entry{}
+	err := bucket.ForEach(func(k, data []byte) error {
+		if bytes.IndexByte(k, 0) >= 0 {
+			return nil
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("failed to decode catalog entry for %s: %w", k, err)
+		}
+		entries[string(k)] = entry
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// a bucket cannot be changed while it is being iterated
+	for key, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode catalog entry for %s: %w", key, err)
+		}
+		if err := bucket.Put([]byte(entry.key()), data); err != nil {
+			return err
+		}
+		if err := bucket.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the entry for the file at the source path with the given size
+// and modification time, and whether one was found. A card that reuses a file
+// name holds a different file, with an entry of its own.
+func (s *Service) Get(sourcePath string, size int64, modTime time.Time) (Entry, bool, error) {
+	var entry Entry
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := get(tx, entriesBucket, []byte(entryKey(sourcePath, size, modTime)))
+		if data == nil {
+			// a catalog opened read only may not have been rekeyed yet
+			data = get(tx, entriesBucket, []byte(sourcePath))
+		}
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		found = entry.Matches(size, modTime)
+		return nil
+	})
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to get catalog entry for %s: %w", sourcePath, err)
+	}
+	if !found {
+		return Entry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+// Put stores the entry, replacing any existing entry for the same source path,
+// size and modification time.
+func (s *Service) Put(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog entry for %s: %w", entry.SourcePath, err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Put([]byte(entry.key()), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put catalog entry for %s: %w", entry.SourcePath, err)
+	}
+	return nil
+}
+
+// Entries calls fn for every entry in source path order, the entries of one
+// source path in the order of their size and modification time.
+func (s *Service) Entries(fn func(Entry) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return forEach(tx, entriesBucket, func(_, data []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return fmt.Errorf("failed to decode catalog entry: %w", err)
+			}
+			return fn(entry)
+		})
+	})
+}
+
+// Hashes calls fn for every file hash in path order.
+func (s *Service) Hashes(fn func(FileHash) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return forEach(tx, hashesBucket, func(_, data []byte) error {
+			var hash FileHash
+			if err := json.Unmarshal(data, &hash); err != nil {
+				return fmt.Errorf("failed to decode file hash: %w", err)
+			}
+			return fn(hash)
+		})
+	})
+}
+
+// PutHashes stores the file hashes in one transaction, replacing any for the same paths.
+func (s *Service) PutHashes(hashes []FileHash) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(hashesBucket)
+		for _, hash := range hashes {
+			data, err := json.Marshal(hash)
+			if err != nil {
+				return fmt.Errorf("failed to encode file hash for %s: %w", hash.Path, err)
+			}
+			if err := bucket.Put([]byte(hash.Path), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put file hashes: %w", err)
+	}
+	return nil
+}
+
+// DeleteHashes removes the file hashes for the paths.
+func (s *Service) DeleteHashes(paths []string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(hashesBucket)
+		for _, path := range paths {
+			if err := bucket.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete file hashes: %w", err)
+	}
+	return nil
+}
+
+// PutJournal stores the journal entry before its transfer starts.
+func (s *Service) PutJournal(entry JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry for %s: %w", entry.key(), err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(journalBucket).Put([]byte(entry.key()), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put journal entry for %s: %w", entry.key(), err)
+	}
+	return nil
+}
+
+// DeleteJournal removes the journal entry once its transfer is recorded or undone.
+func (s *Service) DeleteJournal(entry JournalEntry) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(journalBucket).Delete([]byte(entry.key()))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete journal entry for %s: %w", entry.key(), err)
+	}
+	return nil
+}
+
+// Journal calls fn for every journal entry left by an interrupted run.
+func (s *Service) Journal(fn func(JournalEntry) error) error {
+	entries := []JournalEntry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEach(tx, journalBucket, func(_, data []byte) error {
+			var entry JournalEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return fmt.Errorf("failed to decode journal entry: %w", err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	// fn may update the catalog, which cannot be done inside a read transaction
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Volume returns what the catalog recorded of the volume with the given id,
+// and whether it has a record.
+func (s *Service) Volume(id string) (Volume, bool, error) {
+	var volume Volume
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := get(tx, volumesBucket, []byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &volume)
+	})
+	if err != nil {
+		return Volume{}, false, fmt.Errorf("failed to get volume %s: %w", id, err)
+	}
+	return volume, found, nil
+}
+
+// PutVolume stores the volume, replacing any earlier record of it.
+func (s *Service) PutVolume(volume Volume) error {
+	data, err := json.Marshal(volume)
+	if err != nil {
+		return fmt.Errorf("failed to encode volume %s: %w", volume.ID, err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(volumesBucket).Put([]byte(volume.ID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put volume %s: %w", volume.ID, err)
+	}
+	return nil
+}
+
+// key is the operation and the group's primary file.
+func (e JournalEntry) key() string {
+	if len(e.Files) == 0 {
+		return e.Operation
+	}
+	return e.Operation + "\x00" + e.Files[0].Entry.SourcePath
+}
+
+// key is the source path, size and modification time of the file.
+func (e Entry) key() string {
+	return entryKey(e.SourcePath, e.Size, e.ModTime)
+}
+
+func entryKey(sourcePath string, size int64, modTime time.Time) string {
+	return fmt.Sprintf("%s\x00%d\x00%d", sourcePath, size, modTime.UnixNano())
+}
+
+// Matches reports whether the entry still describes a file of the given size and modification time.
+func (e Entry) Matches(size int64, modTime time.Time) bool {
+	return e.Size == size && e.ModTime.Equal(modTime)
+}
+
+// HasDestination reports whether the file was already sent to a destination of the given kind.
+func (e Entry) HasDestination(kind string) bool {
+	for _, dest := range e.Destinations {
+		if dest.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDestinationPath reports whether the file was already sent to path by a destination of the given kind.
+func (e Entry) HasDestinationPath(kind, path string) bool {
+	for _, dest := range e.Destinations {
+		if dest.Kind == kind && dest.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// DestinationPath returns where the file was last sent by a destination of the given kind, or "".
+func (e Entry) DestinationPath(kind string) string {
+	var path string
+	for _, dest := range e.Destinations {
+		if dest.Kind == kind {
+			path = dest.Path
+		}
+	}
+	return path
+}
+
+func (e *Entry) AddDestination(kind, action, path, checksum string) {
+	e.Destinations = append(e.Destinations, Destination{
+		Kind:       kind,
+		Action:     action,
+		Path:       path,
+		Checksum:   checksum,
+		RecordedAt: time.Now(),
+	})
+}
@@ -0,0 +1,144 @@
+package catalog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestOpenReadOnlyWhileInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	writer, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if err := writer.Put(Entry{SourcePath: "/raw/IMG_0001.CR3", Size: 42}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	entry, found, err := reader.Get("/raw/IMG_0001.CR3", 42, time.Time{})
+	if err != nil || !found || entry.Size != 42 {
+		t.Errorf("Get() = %+v, %v, %v, want the entry", entry, found, err)
+	}
+	if err := reader.Put(Entry{SourcePath: "/raw/IMG_0002.CR3"}); err == nil {
+		t.Error("Put() on a read only catalog succeeded")
+	}
+	tempDir := reader.tempDir
+	if tempDir == "" {
+		t.Error("OpenReadOnly() opened the catalog in use instead of a copy")
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tempDir); !os.IsNotExist(err) {
+		t.Errorf("copy of the catalog kept after Close, stat error = %v", err)
+	}
+}
+
+func TestOpenReadOnlyMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	reader, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	defer reader.Close()
+	if _, found, err := reader.Get("/raw/IMG_0001.CR3", 0, time.Time{}); err != nil || found {
+		t.Errorf("Get() = %v, %v, want nothing", found, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("OpenReadOnly() created the catalog, stat error = %v", err)
+	}
+}
+
+func TestPutKeepsReusedSourcePaths(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	first := Entry{SourcePath: "/card/IMG_0001.CR3", Size: 42, ModTime: time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC)}
+	second := Entry{SourcePath: "/card/IMG_0001.CR3", Size: 43, ModTime: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)}
+	for _, entry := range []Entry{first, second} {
+		if err := s.Put(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []Entry{first, second} {
+		entry, found, err := s.Get(want.SourcePath, want.Size, want.ModTime)
+		if err != nil || !found || !entry.Matches(want.Size, want.ModTime) {
+			t.Errorf("Get(%d, %v) = %+v, %v, %v, want its entry", want.Size, want.ModTime, entry, found, err)
+		}
+	}
+	if _, found, err := s.Get(first.SourcePath, 44, first.ModTime); err != nil || found {
+		t.Errorf("Get() of a changed file = %v, %v, want nothing", found, err)
+	}
+	var count int
+	if err := s.Entries(func(Entry) error { count++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Entries() gave %d entries, want 2", count)
+	}
+}
+
+func TestOpenRekeysEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	entry := Entry{SourcePath: "/card/IMG_0001.CR3", Size: 42, ModTime: time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC)}
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(entriesBucket)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(entry.SourcePath), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	reader, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := reader.Get(entry.SourcePath, entry.Size, entry.ModTime); err != nil || !found {
+		t.Errorf("Get() before rekeying = %v, %v, want the entry", found, err)
+	}
+	reader.Close()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, found, err := s.Get(entry.SourcePath, entry.Size, entry.ModTime); err != nil || !found {
+		t.Errorf("Get() after rekeying = %v, %v, want the entry", found, err)
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(entriesBucket).Get([]byte(entry.SourcePath)) != nil {
+			t.Error("entry still stored under its source path alone")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
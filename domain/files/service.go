@@ -1,12 +1,24 @@
 package files
 
+import (
+	"context"
+	"os"
+)
+
 type fileManager interface {
 	GetFilesInPath(path string) ([]string, error)
 	GetFilesRecursivelyInPath(path string) ([]string, error)
 	DoesFileExist(path string) (bool, error)
 	DoesPathExist(path string) (bool, error)
-	MoveFile(sourcePath, destinationPath string) error
-	CopyFile(sourcePath, destinationPath string) error
+	GetFileInfo(path string) (os.FileInfo, error)
+	MoveFile(ctx context.Context, sourcePath, destinationPath string) (string, error)
+	CopyFile(ctx context.Context, sourcePath, destinationPath string) (string, error)
+	LinkFile(existingPath, destinationPath string) error
+	RemoveFile(path string) error
+	RecordChecksum(rootPath, filePath, checksum string) error
+	RemoveChecksum(rootPath, filePath string) error
+	FlushChecksums() error
+	HashFile(path string) (string, error)
 }
 
 type Service struct {
@@ -35,10 +47,38 @@ func (s *Service) DoesPathExist(path string) (bool, error) {
 	return s.manager.DoesPathExist(path)
 }
 
-func (s *Service) MoveFile(sourcePath, destinationPath string) error {
-	return s.manager.MoveFile(sourcePath, destinationPath)
+func (s *Service) GetFileInfo(path string) (os.FileInfo, error) {
+	return s.manager.GetFileInfo(path)
+}
+
+func (s *Service) MoveFile(ctx context.Context, sourcePath, destinationPath string) (string, error) {
+	return s.manager.MoveFile(ctx, sourcePath, destinationPath)
+}
+
+func (s *Service) CopyFile(ctx context.Context, sourcePath, destinationPath string) (string, error) {
+	return s.manager.CopyFile(ctx, sourcePath, destinationPath)
+}
+
+func (s *Service) LinkFile(existingPath, destinationPath string) error {
+	return s.manager.LinkFile(existingPath, destinationPath)
+}
+
+func (s *Service) RemoveFile(path string) error {
+	return s.manager.RemoveFile(path)
+}
+
+func (s *Service) RecordChecksum(rootPath, filePath, checksum string) error {
+	return s.manager.RecordChecksum(rootPath, filePath, checksum)
+}
+
+func (s *Service) RemoveChecksum(rootPath, filePath string) error {
+	return s.manager.RemoveChecksum(rootPath, filePath)
+}
+
+func (s *Service) FlushChecksums() error {
+	return s.manager.FlushChecksums()
 }
 
-func (s *Service) CopyFile(sourcePath, destinationPath string) error {
-	return s.manager.CopyFile(sourcePath, destinationPath)
+func (s *Service) HashFile(path string) (string, error) {
+	return s.manager.HashFile(path)
 }
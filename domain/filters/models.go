@@ -0,0 +1,67 @@
+package filters
+
+import (
+	"regexp"
+	"time"
+)
+
+const (
+	ActionInclude = "include"
+	ActionExclude = "exclude"
+)
+
+// Rule matches the files that meet every condition it sets, conditions left
+// zero match any file. Path, Camera and Lens are case-insensitive globs, a
+// Path without a / matches the name of the file or of any directory it is in.
+// From and To are the first and last days the file may have been taken on,
+// the sizes and ratings are inclusive bounds.
+type Rule struct {
+	Action     string
+	Path       string
+	Extensions []string
+	MinSize    int64
+	MaxSize    int64
+	Camera     string
+	Lens       string
+	From       time.Time
+	To         time.Time
+	MinRating  *int
+	MaxRating  *int
+	Labels     []string
+}
+
+// Filter decides which files an operation handles. The first rule that
+// matches a file decides, a file no rule matches is included unless the
+// filter has include rules.
+type Filter struct {
+	rules    []rule
+	includes bool
+}
+
+type rule struct {
+	Rule
+	number int
+	path   *regexp.Regexp
+	camera *regexp.Regexp
+	lens   *regexp.Regexp
+}
+
+// File is what the rules are matched against.
+type File struct {
+	// Path is relative to the operation's source path, with / separators.
+	Path string
+	Size int64
+	// Details reads what the file records about how it was taken, it is only
+	// called when a rule needs them.
+	Details func() Details
+}
+
+// Details are read from the file's metadata and XMP. Rating is 0 when the
+// file is unrated.
+type Details struct {
+	Camera string
+	Lens   string
+	Taken  time.Time
+	Rating int
+	Label  string
+}
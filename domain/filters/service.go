@@ -0,0 +1,183 @@
+package filters
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// New returns a filter that tries the rules in order.
+func New(rules []Rule) *Filter {
+	f := &Filter{}
+	for i, r := range rules {
+		f.rules = append(f.rules, rule{
+			Rule:   r,
+			number: i + 1,
+			path:   compileGlob(strings.TrimPrefix(r.Path, "/")),
+			camera: compileGlob(r.Camera),
+			lens:   compileGlob(r.Lens),
+		})
+		f.includes = f.includes || r.Action == ActionInclude
+	}
+	return f
+}
+
+// Match reports whether the file is included and why, naming the rule that
+// decided. A nil filter includes every file.
+func (f *Filter) Match(file File) (bool, string) {
+	if f == nil || len(f.rules) == 0 {
+		return true, ""
+	}
+
+	var details *Details
+	detailsOf := func() Details {
+		if details == nil {
+			d := file.Details()
+			details = &d
+		}
+		return *details
+	}
+	for _, r := range f.rules {
+		if r.matches(file, detailsOf) {
+			return r.Action == ActionInclude, r.String()
+		}
+	}
+	if f.includes {
+		return false, "no include rule matched"
+	}
+	return true, ""
+}
+
+// matches checks the conditions that only need the path and size first, so
+// the file's metadata is only read when they pass.
+func (r rule) matches(file File, detailsOf func() Details) bool {
+	if r.path != nil && !matchesPath(r.path, r.Path, file.Path) {
+		return false
+	}
+	if len(r.Extensions) > 0 && !containsFold(r.Extensions, strings.TrimPrefix(path.Ext(file.Path), ".")) {
+		return false
+	}
+	if r.MinSize > 0 && file.Size < r.MinSize || r.MaxSize > 0 && file.Size > r.MaxSize {
+		return false
+	}
+	if !r.needsDetails() {
+		return true
+	}
+
+	d := detailsOf()
+	if r.camera != nil && !r.camera.MatchString(d.Camera) {
+		return false
+	}
+	if r.lens != nil && !r.lens.MatchString(d.Lens) {
+		return false
+	}
+	if !r.From.IsZero() || !r.To.IsZero() {
+		if d.Taken.IsZero() {
+			return false
+		}
+		day := time.Date(d.Taken.Year(), d.Taken.Month(), d.Taken.Day(), 0, 0, 0, 0, time.UTC)
+		if !r.From.IsZero() && day.Before(r.From) || !r.To.IsZero() && day.After(r.To) {
+			return false
+		}
+	}
+	if r.MinRating != nil && d.Rating < *r.MinRating || r.MaxRating != nil && d.Rating > *r.MaxRating {
+		return false
+	}
+	if len(r.Labels) > 0 && !containsFold(r.Labels, d.Label) {
+		return false
+	}
+	return true
+}
+
+func (r rule) needsDetails() bool {
+	return r.camera != nil || r.lens != nil || !r.From.IsZero() || !r.To.IsZero() ||
+		r.MinRating != nil || r.MaxRating != nil || len(r.Labels) > 0
+}
+
+// String describes the rule by its number and conditions, such as
+// "rule 2: exclude path=._*".
+func (r rule) String() string {
+	conditions := []string{}
+	add := func(name, value string) {
+		if value != "" {
+			conditions = append(conditions, name+"="+value)
+		}
+	}
+	add("path", r.Path)
+	add("extensions", strings.Join(r.Extensions, ","))
+	if r.MinSize > 0 {
+		add("min_size", fmt.Sprint(r.MinSize))
+	}
+	if r.MaxSize > 0 {
+		add("max_size", fmt.Sprint(r.MaxSize))
+	}
+	add("camera", r.Camera)
+	add("lens", r.Lens)
+	if !r.From.IsZero() {
+		add("from", r.From.Format(time.DateOnly))
+	}
+	if !r.To.IsZero() {
+		add("to", r.To.Format(time.DateOnly))
+	}
+	if r.MinRating != nil {
+		add("min_rating", fmt.Sprint(*r.MinRating))
+	}
+	if r.MaxRating != nil {
+		add("max_rating", fmt.Sprint(*r.MaxRating))
+	}
+	add("labels", strings.Join(r.Labels, ","))
+	return fmt.Sprintf("rule %d: %s %s", r.number, r.Action, strings.Join(conditions, " "))
+}
+
+// compileGlob turns a glob into a case-insensitive regexp, ** matches across
+// directories, * and ? within one. It returns nil for an empty glob.
+func compileGlob(glob string) *regexp.Regexp {
+	if glob == "" {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// matchesPath matches a glob with a / against the whole path, and one
+// without against each of its names.
+func matchesPath(re *regexp.Regexp, glob, filePath string) bool {
+	if strings.Contains(glob, "/") {
+		return re.MatchString(strings.TrimPrefix(filePath, "/"))
+	}
+	for _, name := range strings.Split(filePath, "/") {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evanoberholster/imagemeta/exif2"
+)
+
+const (
+	ContainerJPEG    = "jpeg"
+	ContainerTIFF    = "tiff"
+	ContainerISOBMFF = "isobmff"
+	ContainerRAF     = "raf"
+)
+
+// Format is a photo file format, the container its metadata is stored in and
+// how to decode it.
+type Format struct {
+	Extension string
+	Name      string
+	Container string
+	Raw       bool
+	decode    decoder
+}
+
+// UnsupportedFormat is a photo format that is recognised but whose metadata
+// cannot be read, its files are not sorted.
+type UnsupportedFormat struct {
+	Extension string
+	Name      string
+	Reason    string
+}
+
+type decoder func(f *os.File) (exif2.Exif, exifTags, error)
+
+// formats are the photo formats that are sorted, by extension.
+var formats = []Format{
+	{Extension: "jpg", Name: "JPEG", Container: ContainerJPEG, decode: decodeFile},
+	{Extension: "jpeg", Name: "JPEG", Container: ContainerJPEG, decode: decodeFile},
+	{Extension: "heic", Name: "HEIF (HEVC)", Container: ContainerISOBMFF, decode: decodeFile},
+	{Extension: "heif", Name: "HEIF", Container: ContainerISOBMFF, decode: decodeFile},
+	{Extension: "cr3", Name: "Canon CR3", Container: ContainerISOBMFF, Raw: true, decode: decodeFile},
+	{Extension: "cr2", Name: "Canon CR2", Container: ContainerTIFF, Raw: true, decode: decodeFile},
+	{Extension: "dng", Name: "Adobe DNG", Container: ContainerTIFF, Raw: true, decode: decodeFile},
+	{Extension: "nef", Name: "Nikon NEF", Container: ContainerTIFF, Raw: true, decode: decodeFile},
+	{Extension: "arw", Name: "Sony ARW", Container: ContainerTIFF, Raw: true, decode: decodeFile},
+	{Extension: "rw2", Name: "Panasonic RW2", Container: ContainerTIFF, Raw: true, decode: decodeRW2},
+	{Extension: "raw", Name: "RAW", Container: ContainerTIFF, Raw: true, decode: decodeRAW},
+	{Extension: "orf", Name: "Olympus ORF", Container: ContainerTIFF, Raw: true, decode: decodeORF},
+	{Extension: "raf", Name: "Fujifilm RAF", Container: ContainerRAF, Raw: true, decode: decodeRAF},
+}
+
+// unsupportedFormats are photo formats that are known but skipped.
+var unsupportedFormats = []UnsupportedFormat{
+	{Extension: "crw", Name: "Canon CRW", Reason: "CIFF metadata is not supported"},
+	{Extension: "x3f", Name: "Sigma X3F", Reason: "X3F metadata is not supported"},
+	{Extension: "png", Name: "PNG", Reason: "PNG files carry no capture metadata"},
+	{Extension: "gif", Name: "GIF", Reason: "GIF files carry no capture metadata"},
+	{Extension: "webp", Name: "WebP", Reason: "WebP metadata is not supported"},
+	{Extension: "psd", Name: "Photoshop PSD", Reason: "edited files are not sorted"},
+}
+
+// GetFormats returns the photo formats that are sorted.
+func GetFormats() []Format {
+	return formats
+}
+
+// GetUnsupportedFormats returns the photo formats that are recognised but skipped.
+func GetUnsupportedFormats() []UnsupportedFormat {
+	return unsupportedFormats
+}
+
+// LookupFormat returns the format of the file from its extension.
+func LookupFormat(path string) (Format, bool) {
+	ext := fileExtension(path)
+	for _, f := range formats {
+		if f.Extension == ext {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// LookupUnsupportedFormat returns the format of the file when it is a known format that is skipped.
+func LookupUnsupportedFormat(path string) (UnsupportedFormat, bool) {
+	ext := fileExtension(path)
+	for _, f := range unsupportedFormats {
+		if f.Extension == ext {
+			return f, true
+		}
+	}
+	return UnsupportedFormat{}, false
+}
+
+// GetRawTypes returns the extensions of the raw formats.
+func GetRawTypes() []string {
+	types := []string{}
+	for _, f := range formats {
+		if f.Raw {
+			types = append(types, f.Extension)
+		}
+	}
+	return types
+}
+
+// GetEditedTypes returns the extensions of the formats that are not raw, the
+// formats edited photos are exported in.
+func GetEditedTypes() []string {
+	types := []string{}
+	for _, f := range formats {
+		if !f.Raw {
+			types = append(types, f.Extension)
+		}
+	}
+	return types
+}
+
+func fileExtension(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// decodeFile reads formats the metadata library recognises from their header.
+func decodeFile(f *os.File) (exif2.Exif, exifTags, error) {
+	return decode(f)
+}
+
+var (
+	tiffLittleEndian = []byte{'I', 'I', 0x2a, 0x00}
+	tiffBigEndian    = []byte{'M', 'M', 0x00, 0x2a}
+)
+
+// decodeORF reads an Olympus ORF as the TIFF file it is. Its header has its
+// own version, IIRO, IIRS or MMOR, so it is replaced with the TIFF version.
+func decodeORF(f *os.File) (exif2.Exif, exifTags, error) {
+	return decodeTIFFVariant(f, "ORF", map[string][]byte{"IIRO": tiffLittleEndian, "IIRS": tiffLittleEndian, "MMOR": tiffBigEndian})
+}
+
+// decodeRW2 reads a Panasonic RW2 or RAW as the TIFF file it is. Its header
+// has the version 0x55 instead of 0x2a, which the metadata library does not
+// take for TIFF.
+func decodeRW2(f *os.File) (exif2.Exif, exifTags, error) {
+	return decodeTIFFVariant(f, "RW2", map[string][]byte{"IIU\x00": tiffLittleEndian})
+}
+
+// decodeRAW reads a .raw file as an RW2 when it has the Panasonic header, as
+// Panasonic and Leica write it, and otherwise leaves it to the metadata
+// library, as other cameras use the extension for their own formats.
+func decodeRAW(f *os.File) (exif2.Exif, exifTags, error) {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(f, header)
+	if _, seekErr := f.Seek(0, io.SeekStart); seekErr != nil {
+		return exif2.Exif{}, exifTags{}, fmt.Errorf("failed to seek RAW file: %w", seekErr)
+	}
+	if err == nil && string(header) == "IIU\x00" {
+		return decodeRW2(f)
+	}
+	return decodeFile(f)
+}
+
+// decodeTIFFVariant decodes a TIFF whose first four bytes are one of the
+// headers, replaced with the TIFF header they stand for.
+func decodeTIFFVariant(f *os.File, name string, headers map[string][]byte) (exif2.Exif, exifTags, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return exif2.Exif{}, exifTags{}, fmt.Errorf("failed to read %s header: %w", name, err)
+	}
+	tiffHeader, ok := headers[string(header)]
+	if !ok {
+		return exif2.Exif{}, exifTags{}, fmt.Errorf("not an %s file, header %q", name, header)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return exif2.Exif{}, exifTags{}, fmt.Errorf("failed to stat %s file: %w", name, err)
+	}
+	return decode(&patchedReader{ReaderAt: f, header: tiffHeader, size: info.Size()})
+}
+
+// patchedReader reads a file with its first bytes replaced by header.
+type patchedReader struct {
+	io.ReaderAt
+	header []byte
+	size   int64
+	offset int64
+}
+
+func (r *patchedReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	n, err := r.ReadAt(p, r.offset)
+	if r.offset < int64(len(r.header)) {
+		copy(p[:n], r.header[r.offset:])
+	}
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *patchedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position: %d", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+const (
+	rafMagic = "FUJIFILMCCD-RAW"
+	// rafPreviewOffset is where the RAF header stores the offset and length
+	// of the embedded JPEG preview, which holds the EXIF metadata.
+	rafPreviewOffset = 84
+)
+
+// decodeRAF reads a Fujifilm RAF from the JPEG preview it embeds.
+func decodeRAF(f *os.File) (exif2.Exif, exifTags, error) {
+	header := make([]byte, rafPreviewOffset+8)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return exif2.Exif{}, exifTags{}, fmt.Errorf("failed to read RAF header: %w", err)
+	}
+	if !bytes.HasPrefix(header, []byte(rafMagic)) {
+		return exif2.Exif{}, exifTags{}, fmt.Errorf("not a RAF file, header %q", header[:len(rafMagic)])
+	}
+	offset := binary.BigEndian.Uint32(header[rafPreviewOffset:])
+	length := binary.BigEndian.Uint32(header[rafPreviewOffset+4:])
+	if offset == 0 || length == 0 {
+		return exif2.Exif{}, exifTags{}, fmt.Errorf("RAF file has no JPEG preview")
+	}
+	return decode(io.NewSectionReader(f, int64(offset), int64(length)))
+}
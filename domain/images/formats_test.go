@@ -0,0 +1,76 @@
+package images
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestGetPhotoFormats(t *testing.T) {
+	zone := time.FixedZone("+02:00", 2*60*60)
+	taken := time.Date(2023, 7, 14, 9, 30, 15, 0, zone)
+
+	tests := []struct {
+		file  string
+		model string
+	}{
+		{"photo.jpg", "canon eos r5"},
+		{"photo.heic", "iphone 14 pro"},
+		{"photo.cr2", "canon eos 5d mark iv"},
+		{"photo.dng", "leica q2"},
+		{"photo.nef", "nikon d850"},
+		{"photo.arw", "ilce-7m4"},
+		{"photo.rw2", "dc-s5"},
+		{"photo.raw", "dmc-lx100"},
+		{"tiff.raw", "dcs pro 14n"},
+		{"photo.orf", "e-m1markiii"},
+		{"photo.raf", "x-t5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if _, ok := LookupFormat(tt.file); !ok {
+				t.Fatalf("no format registered for %s", tt.file)
+			}
+
+			photo, err := GetPhoto(zap.NewNop(), filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("GetPhoto() error = %v", err)
+			}
+			if got := photo.GetCameraModel(); got != tt.model {
+				t.Errorf("camera model = %q, want %q", got, tt.model)
+			}
+			got := photo.GetTimestamp()
+			if !got.Equal(taken) {
+				t.Errorf("timestamp = %v, want %v", got, taken)
+			}
+			if _, offset := got.Zone(); offset != 2*60*60 {
+				t.Errorf("timestamp offset = %ds, want %ds", offset, 2*60*60)
+			}
+			if source := photo.GetTimeZoneSource(); source != ZoneOffsetTime {
+				t.Errorf("time zone source = %q, want %q", source, ZoneOffsetTime)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsWrongHeader(t *testing.T) {
+	jpeg, err := os.ReadFile(filepath.Join("testdata", "photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a JPEG renamed to a raw extension has the wrong magic for its decoder
+	for _, name := range []string{"photo.orf", "photo.rw2", "photo.raf"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, jpeg, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := GetPhoto(zap.NewNop(), path); err == nil {
+				t.Fatal("GetPhoto() error = nil, want an error for the wrong header")
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package images
+
+import (
+	"math"
+
+	"github.com/evanoberholster/imagemeta/exif2"
+	"github.com/evanoberholster/imagemeta/exif2/ifds"
+	"github.com/evanoberholster/imagemeta/exif2/ifds/gpsifd"
+)
+
+// Metadata is what a photo records about how it was taken. Values the photo
+// does not record are nil, and null in JSON, rather than zero.
+type Metadata struct {
+	CameraModel *string `json:"camera_model"`
+	BodySerial  *string `json:"body_serial"`
+	LensModel   *string `json:"lens_model"`
+	// FocalLength is in millimeters, Aperture is the f-number and
+	// ExposureTime is in seconds.
+	FocalLength  *float64 `json:"focal_length"`
+	Aperture     *float64 `json:"aperture"`
+	ExposureTime *float64 `json:"exposure_time"`
+	ISO          *int     `json:"iso"`
+	// Orientation is the EXIF orientation, 1 to 8.
+	Orientation *int `json:"orientation"`
+	Width       *int `json:"width"`
+	Height      *int `json:"height"`
+	// ShutterCount is the EXIF ImageNumber, which bodies that record it use
+	// for the number of shutter actuations.
+	ShutterCount *int `json:"shutter_count"`
+	Rating       *int `json:"rating"`
+	// Latitude and Longitude are in degrees, Altitude in meters above sea level.
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Altitude  *float64 `json:"altitude"`
+}
+
+// toMetadata reads the metadata from the decoded EXIF data. A value is present
+// when the photo has its tag, so an altitude of 0 m or a rating of 0 is kept.
+// Focal length, aperture, exposure time, ISO and dimensions of zero are not
+// measurements, cameras write zero there when they do not know, and are left
+// out like a missing tag.
+func toMetadata(e exif2.Exif, tags exifTags) Metadata {
+	m := Metadata{
+		CameraModel:  nonEmpty(e.Model),
+		BodySerial:   nonEmpty(e.CameraSerial),
+		LensModel:    nonEmpty(e.LensModel),
+		FocalLength:  nonZero(round(float64(e.FocalLength), 1)),
+		Aperture:     nonZero(round(float64(e.FNumber), 1)),
+		ExposureTime: nonZero(round(float64(e.ExposureTime), 6)),
+		ISO:          nonZero(int(e.ISOSpeed)),
+		Width:        nonZero(int(e.ImageWidth)),
+		Height:       nonZero(int(e.ImageHeight)),
+		Orientation:  found(tags.has(ifds.IFD0, ifds.Orientation), int(e.Orientation)),
+		ShutterCount: found(tags.has(ifds.ExifIFD, ifds.ImageNumber), tags.imageNumber),
+		Rating:       found(tags.has(ifds.IFD0, ifds.Rating), tags.rating),
+	}
+	if !tags.has(ifds.GPSIFD, gpsifd.GPSLatitude) || !tags.has(ifds.GPSIFD, gpsifd.GPSLongitude) {
+		return m
+	}
+	// 0,0 is in the ocean, cameras without a fix leave the coordinates at zero
+	if e.GPS.Latitude() != 0 || e.GPS.Longitude() != 0 {
+		latitude, longitude := e.GPS.Latitude(), e.GPS.Longitude()
+		m.Latitude, m.Longitude = &latitude, &longitude
+		m.Altitude = found(tags.has(ifds.GPSIFD, gpsifd.GPSAltitude), round(float64(e.GPS.Altitude()), 1))
+	}
+	return m
+}
+
+// found returns v if the photo has its tag, and nil if not.
+func found[T any](has bool, v T) *T {
+	if !has {
+		return nil
+	}
+	return &v
+}
+
+// nonZero returns nil for a zero measurement.
+func nonZero[T int | float64](v T) *T {
+	return found(v != 0, v)
+}
+
+// nonEmpty returns nil for an empty string, which a tag holding only padding reads as.
+func nonEmpty(s string) *string {
+	return found(s != "", s)
+}
+
+// value returns the value and whether it is present.
+func value[T any](p *T) (T, bool) {
+	if p == nil {
+		var zero T
+		return zero, false
+	}
+	return *p, true
+}
+
+func round(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
@@ -0,0 +1,56 @@
+package images
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMetadataKeepsZeroValues(t *testing.T) {
+	photo, err := GetPhoto(zap.NewNop(), filepath.Join("testdata", "zeros.dng"))
+	if err != nil {
+		t.Fatalf("GetPhoto() error = %v", err)
+	}
+
+	if rating, ok := photo.GetRating(); !ok || rating != 0 {
+		t.Errorf("GetRating() = %d, %v, want 0, true", rating, ok)
+	}
+	if altitude, ok := photo.GetAltitude(); !ok || altitude != 0 {
+		t.Errorf("GetAltitude() = %v, %v, want 0, true", altitude, ok)
+	}
+	latitude, longitude, ok := photo.GetLocation()
+	if !ok || math.Abs(latitude-51.5) > 1e-9 || math.Abs(longitude-0.1) > 1e-9 {
+		t.Errorf("GetLocation() = %v, %v, %v, want 51.5, 0.1, true", latitude, longitude, ok)
+	}
+	if count, ok := photo.GetShutterCount(); !ok || count != 1234 {
+		t.Errorf("GetShutterCount() = %d, %v, want 1234, true", count, ok)
+	}
+	if orientation, ok := photo.GetOrientation(); !ok || orientation != 1 {
+		t.Errorf("GetOrientation() = %d, %v, want 1, true", orientation, ok)
+	}
+}
+
+func TestMetadataMissingValues(t *testing.T) {
+	photo, err := GetPhoto(zap.NewNop(), filepath.Join("testdata", "photo.dng"))
+	if err != nil {
+		t.Fatalf("GetPhoto() error = %v", err)
+	}
+
+	if rating, ok := photo.GetRating(); ok {
+		t.Errorf("GetRating() = %d, true, want absent", rating)
+	}
+	if altitude, ok := photo.GetAltitude(); ok {
+		t.Errorf("GetAltitude() = %v, true, want absent", altitude)
+	}
+	if _, _, ok := photo.GetLocation(); ok {
+		t.Error("GetLocation() present, want absent")
+	}
+	if count, ok := photo.GetShutterCount(); ok {
+		t.Errorf("GetShutterCount() = %d, true, want absent", count)
+	}
+	if aperture, ok := photo.GetAperture(); ok {
+		t.Errorf("GetAperture() = %v, true, want absent", aperture)
+	}
+}
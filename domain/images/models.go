@@ -7,7 +7,20 @@ type ImageData struct {
 	filePath    string
 	cameraModel string
 	timestamp   time.Time
+	createDate  time.Time
+	zoneSource  string
+	metadata    Metadata
 	DestPath    string
 }
 
-var imageFileTypes = []string{"jpg", "jpeg", "raw", "cr3", "cr2"}
+const (
+	ZoneOffsetTime = "offset_time"
+	ZoneGPS        = "gps"
+)
+
+const (
+	// gpsOffsetStep rounds the difference between the camera and GPS clocks
+	// to a zone offset, every zone is a multiple of 15 minutes from UTC.
+	gpsOffsetStep = 15 * time.Minute
+	maxZoneOffset = 14 * time.Hour
+)
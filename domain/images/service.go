@@ -6,7 +6,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/evanoberholster/imagemeta"
 	"github.com/evanoberholster/imagemeta/exif2"
 	"go.uber.org/zap"
 )
@@ -19,26 +18,85 @@ func GetPhoto(_ *zap.Logger, path string) (ImageData, error) {
 	}
 	defer f.Close()
 
-	e, err := imagemeta.Decode(f)
+	decode := decodeFile
+	if format, ok := LookupFormat(path); ok {
+		decode = format.decode
+	}
+	e, tags, err := decode(f)
 	if err != nil {
 		return i, fmt.Errorf("failed to decode image: %w", err)
 	}
 
 	sepPath := strings.Split(path, "/")
-	return toImageData(e, sepPath[len(sepPath)-1], path), nil
+	return toImageData(e, tags, sepPath[len(sepPath)-1], path), nil
 }
 
-func toImageData(e exif2.Exif, name, path string) ImageData {
-	return ImageData{
+func toImageData(e exif2.Exif, tags exifTags, name, path string) ImageData {
+	i := ImageData{
 		fileName:    name,
 		filePath:    path,
 		cameraModel: e.Model,
 		timestamp:   e.DateTimeOriginal(),
+		createDate:  e.CreateDate(),
+		metadata:    toMetadata(e, tags),
+	}
+
+	zone, source := timeZone(e)
+	if zone != nil {
+		i.timestamp = inZone(i.timestamp, zone)
+		i.createDate = inZone(i.createDate, zone)
+		i.zoneSource = source
+	}
+	return i
+}
+
+// timeZone returns the zone the photo was taken in, from the EXIF offset of
+// the capture, digitized or modify time, or else from the difference between
+// the camera's clock and the GPS time, which is UTC. It returns nil when the
+// photo records neither.
+func timeZone(e exif2.Exif) (*time.Location, string) {
+	original := e.DateTimeOriginal()
+	for _, t := range []time.Time{original, e.CreateDate(), e.ModifyDate()} {
+		if t.Location() != time.UTC {
+			return t.Location(), ZoneOffsetTime
+		}
+	}
+
+	gps := e.GPS.Date()
+	if gps.IsZero() || original.IsZero() {
+		return nil, ""
+	}
+	offset := original.Sub(gps).Round(gpsOffsetStep)
+	if offset < -maxZoneOffset || offset > maxZoneOffset {
+		return nil, ""
+	}
+	return time.FixedZone(formatZoneOffset(offset), int(offset.Seconds())), ZoneGPS
+}
+
+// inZone reads the wall clock of t as a time in zone.
+func inZone(t time.Time, zone *time.Location) time.Time {
+	if t.IsZero() {
+		return t
 	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
 }
 
+func formatZoneOffset(offset time.Duration) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, int(offset.Hours()), int(offset.Minutes())%60)
+}
+
+// GetImageTypes returns the extensions of the photo formats that are sorted.
 func GetImageTypes() []string {
-	return imageFileTypes
+	types := make([]string, len(formats))
+	for i, f := range formats {
+		types[i] = f.Extension
+	}
+	return types
 }
 
 func (i ImageData) GetFileName() string {
@@ -53,6 +111,83 @@ func (i ImageData) GetCameraModel() string {
 	return strings.ToLower(i.cameraModel)
 }
 
+// GetCameraSerial returns the body serial number, when the camera records it.
+func (i ImageData) GetCameraSerial() string {
+	serial, _ := value(i.metadata.BodySerial)
+	return serial
+}
+
+// GetTimeZoneSource returns where the zone of the timestamps came from,
+// ZoneOffsetTime or ZoneGPS, or "" when they are wall clock times in an
+// unknown zone.
+func (i ImageData) GetTimeZoneSource() string {
+	return i.zoneSource
+}
+
 func (i ImageData) GetTimestamp() time.Time {
 	return i.timestamp
 }
+
+// GetCreateDate returns when the camera wrote the file, which can differ from when it was taken.
+func (i ImageData) GetCreateDate() time.Time {
+	return i.createDate
+}
+
+// GetMetadata returns everything the photo records about how it was taken.
+func (i ImageData) GetMetadata() Metadata {
+	return i.metadata
+}
+
+func (i ImageData) GetLensModel() (string, bool) {
+	return value(i.metadata.LensModel)
+}
+
+// GetFocalLength returns the focal length in millimeters.
+func (i ImageData) GetFocalLength() (float64, bool) {
+	return value(i.metadata.FocalLength)
+}
+
+// GetAperture returns the f-number.
+func (i ImageData) GetAperture() (float64, bool) {
+	return value(i.metadata.Aperture)
+}
+
+// GetExposureTime returns the shutter speed in seconds.
+func (i ImageData) GetExposureTime() (float64, bool) {
+	return value(i.metadata.ExposureTime)
+}
+
+func (i ImageData) GetISO() (int, bool) {
+	return value(i.metadata.ISO)
+}
+
+func (i ImageData) GetOrientation() (int, bool) {
+	return value(i.metadata.Orientation)
+}
+
+// GetDimensions returns the width and height in pixels.
+func (i ImageData) GetDimensions() (int, int, bool) {
+	width, ok := value(i.metadata.Width)
+	height, ok2 := value(i.metadata.Height)
+	return width, height, ok && ok2
+}
+
+func (i ImageData) GetShutterCount() (int, bool) {
+	return value(i.metadata.ShutterCount)
+}
+
+func (i ImageData) GetRating() (int, bool) {
+	return value(i.metadata.Rating)
+}
+
+// GetLocation returns the GPS latitude and longitude in degrees.
+func (i ImageData) GetLocation() (float64, float64, bool) {
+	latitude, ok := value(i.metadata.Latitude)
+	longitude, _ := value(i.metadata.Longitude)
+	return latitude, longitude, ok
+}
+
+// GetAltitude returns the GPS altitude in meters above sea level.
+func (i ImageData) GetAltitude() (float64, bool) {
+	return value(i.metadata.Altitude)
+}
@@ -0,0 +1,46 @@
+package images
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestTimeZone(t *testing.T) {
+	tests := []struct {
+		file string
+		// offset is the zone of the timestamp in seconds east of UTC,
+		// source where it came from
+		offset int
+		source string
+	}{
+		{"photo.dng", 2 * 60 * 60, ZoneOffsetTime},
+		{"zone_offset_gps.dng", 2 * 60 * 60, ZoneOffsetTime},
+		{"zone_gps.dng", 2 * 60 * 60, ZoneGPS},
+		{"zone_gps_west.dng", -5 * 60 * 60, ZoneGPS},
+		{"zone_gps_invalid.dng", 0, ""},
+		{"zone_none.dng", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			photo, err := GetPhoto(zap.NewNop(), filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("GetPhoto() error = %v", err)
+			}
+			if source := photo.GetTimeZoneSource(); source != tt.source {
+				t.Errorf("time zone source = %q, want %q", source, tt.source)
+			}
+			// the wall clock is what the camera recorded, whatever the zone
+			got := photo.GetTimestamp()
+			wall := time.Date(got.Year(), got.Month(), got.Day(), got.Hour(), got.Minute(), got.Second(), 0, time.UTC)
+			if want := time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC); !wall.Equal(want) {
+				t.Errorf("timestamp = %v, want the wall clock %v", got, want)
+			}
+			if _, offset := got.Zone(); offset != tt.offset {
+				t.Errorf("timestamp offset = %ds, want %ds", offset, tt.offset)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package images
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/evanoberholster/imagemeta"
+	"github.com/evanoberholster/imagemeta/exif2"
+	"github.com/evanoberholster/imagemeta/exif2/ifds"
+	"github.com/evanoberholster/imagemeta/exif2/tag"
+	"github.com/evanoberholster/imagemeta/imagetype"
+	"github.com/evanoberholster/imagemeta/isobmff"
+	"github.com/evanoberholster/imagemeta/jpeg"
+	"github.com/evanoberholster/imagemeta/tiff"
+)
+
+// exifTags is what a second pass over the EXIF data finds: which tags the
+// photo has, as the metadata library gives zero both for a tag that is missing
+// and for one whose value is zero, and the values of tags the library skips.
+type exifTags struct {
+	found       map[tagKey]bool
+	rating      int
+	imageNumber int
+}
+
+type tagKey struct {
+	ifd ifds.IfdType
+	id  tag.ID
+}
+
+// has reports whether the photo has the tag in the given IFD.
+func (t exifTags) has(ifd ifds.IfdType, id tag.ID) bool {
+	return t.found[tagKey{ifd, id}]
+}
+
+// decode reads the EXIF data of r and then the tags it has.
+func decode(r io.ReadSeeker) (exif2.Exif, exifTags, error) {
+	e, err := imagemeta.Decode(r)
+	if err != nil {
+		return e, exifTags{}, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return e, exifTags{}, fmt.Errorf("failed to rewind for EXIF tags: %w", err)
+	}
+	tags, err := scanTags(r)
+	if err != nil {
+		return e, exifTags{}, fmt.Errorf("failed to read EXIF tags: %w", err)
+	}
+	return e, tags, nil
+}
+
+// scanTags walks the EXIF tags of r the way imagemeta.Decode does, noting
+// each one instead of parsing it.
+func scanTags(r io.Reader) (exifTags, error) {
+	tags := exifTags{found: map[tagKey]bool{}}
+	ir := exif2.NewIfdReader(exif2.Logger)
+	defer ir.Close()
+	ir.SetCustomTagParser(func(p exif2.TagParser, t exif2.Tag) error {
+		tags.found[tagKey{t.Ifd, t.ID}] = true
+		switch {
+		case t.Ifd == ifds.IFD0 && t.ID == ifds.Rating:
+			tags.rating = int(p.ParseUint16(t))
+		case t.Ifd == ifds.ExifIFD && t.ID == ifds.ImageNumber:
+			tags.imageNumber = int(p.ParseUint32(t))
+		}
+		return nil
+	})
+
+	br := bufio.NewReader(r)
+	it, err := imagetype.ScanBuf(br)
+	if err != nil {
+		return tags, err
+	}
+	switch it {
+	case imagetype.ImageJPEG:
+		return tags, jpeg.ScanJPEG(br, ir.DecodeJPEGIfd, nil)
+	case imagetype.ImageCR2, imagetype.ImageTiff, imagetype.ImagePanaRAW, imagetype.ImageDNG, imagetype.ImageHEIF:
+		header, err := tiff.ScanTiffHeader(br, it)
+		if err != nil {
+			return tags, err
+		}
+		return tags, ir.DecodeTiff(br, header)
+	case imagetype.ImageCR3, imagetype.ImageAVIF:
+		bmr := isobmff.NewReader(br)
+		defer bmr.Close()
+		bmr.ExifReader = ir.DecodeIfd
+		if err := bmr.ReadFTYP(); err != nil {
+			return tags, err
+		}
+		return tags, bmr.ReadMetadata()
+	default:
+		return tags, imagemeta.ErrMetadataNotSupported
+	}
+}
@@ -0,0 +1,290 @@
+//go:build ignore
+
+// generate writes the photo fixtures in this directory, each a minimal file
+// holding only the metadata the tests read, built around one little-endian
+// TIFF. They are not real camera files. The JPEG, CR2, RW2, ORF and RAF
+// fixtures have the header or wrapper of their format, the HEIC fixture is
+// only an ftyp box and an mdat box holding the EXIF, with no HEIF item
+// structure, and the DNG, NEF and ARW fixtures are the bare TIFF, without the
+// maker notes, previews and image data of real files. They test how each
+// extension is decoded, not every camera's output. Run it from this directory
+// with go run generate.go.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+)
+
+type fixture struct {
+	name  string
+	make  string
+	model string
+	build func(tiff []byte) []byte
+}
+
+var fixtures = []fixture{
+	{"photo.jpg", "Canon", "Canon EOS R5", jpeg},
+	{"photo.heic", "Apple", "iPhone 14 Pro", heic},
+	{"photo.cr2", "Canon", "Canon EOS 5D Mark IV", cr2},
+	{"photo.dng", "Leica Camera AG", "LEICA Q2", plain},
+	{"photo.nef", "NIKON CORPORATION", "NIKON D850", plain},
+	{"photo.arw", "SONY", "ILCE-7M4", plain},
+	{"photo.rw2", "Panasonic", "DC-S5", rw2},
+	{"photo.raw", "Panasonic", "DMC-LX100", rw2},
+	{"tiff.raw", "Kodak", "DCS Pro 14N", plain},
+	{"photo.orf", "OLYMPUS CORPORATION", "E-M1MarkIII", orf},
+	{"photo.raf", "FUJIFILM", "X-T5", raf},
+}
+
+const (
+	dateTimeOriginal   = "2023:07:14 09:30:15"
+	offsetTimeOriginal = "+02:00"
+)
+
+// zoneFixtures record the capture time with or without its offset and with
+// or without the GPS time, in UTC, the zone can be worked out from.
+var zoneFixtures = []struct {
+	name    string
+	offset  string
+	gpsTime string
+}{
+	{"zone_offset_gps.dng", offsetTimeOriginal, "2023:07:14 04:30:15"},
+	{"zone_gps.dng", "", "2023:07:14 07:31:02"},
+	{"zone_gps_west.dng", "", "2023:07:14 14:30:15"},
+	{"zone_gps_invalid.dng", "", "2023:07:13 09:30:15"},
+	{"zone_none.dng", "", ""},
+}
+
+func main() {
+	for _, f := range fixtures {
+		if err := os.WriteFile(f.name, f.build(tiff(f.make, f.model)), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := os.WriteFile("zeros.dng", zeros(), 0644); err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range zoneFixtures {
+		if err := os.WriteFile(f.name, zoned(f.offset, f.gpsTime), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+type entry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	data  []byte
+	value uint32
+}
+
+func ascii(tag uint16, s string) entry {
+	data := append([]byte(s), 0)
+	return entry{tag: tag, kind: 2, count: uint32(len(data)), data: data}
+}
+
+// tiff returns a little endian TIFF whose IFD0 holds the make and model and
+// whose EXIF IFD holds the capture time and its offset. Offsets are from the
+// start of the TIFF header.
+func tiff(make, model string) []byte {
+	exif := []entry{ascii(0x9003, dateTimeOriginal), ascii(0x9011, offsetTimeOriginal)}
+	ifd0 := []entry{ascii(0x010f, make), ascii(0x0110, model), {tag: 0x8769, kind: 4, count: 1}}
+
+	ifd0Offset := uint32(8)
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	ifd0[2].value = exifOffset
+
+	var b bytes.Buffer
+	b.WriteString("II*\x00")
+	binary.Write(&b, binary.LittleEndian, ifd0Offset)
+	writeIFD(&b, ifd0, ifd0Offset)
+	writeIFD(&b, exif, exifOffset)
+	return b.Bytes()
+}
+
+func short(tag uint16, v uint16) entry {
+	return entry{tag: tag, kind: 3, count: 1, value: uint32(v)}
+}
+
+func rational(tag uint16, values ...uint32) entry {
+	data := []byte{}
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, v)
+		data = binary.LittleEndian.AppendUint32(data, 1)
+	}
+	return entry{tag: tag, kind: 5, count: uint32(len(values)), data: data}
+}
+
+// zeros returns a TIFF whose rating and GPS altitude are recorded as zero,
+// which must not read as missing, with a GPS position and an image number.
+func zeros() []byte {
+	ifd0 := []entry{ascii(0x010f, "Leica Camera AG"), ascii(0x0110, "LEICA Q2"), short(0x0112, 1), short(0x4746, 0),
+		{tag: 0x8769, kind: 4, count: 1}, {tag: 0x8825, kind: 4, count: 1}}
+	exif := []entry{ascii(0x9003, dateTimeOriginal), {tag: 0x9211, kind: 4, count: 1, value: 1234}}
+	gps := []entry{ascii(0x0001, "N"), rational(0x0002, 51, 30, 0), ascii(0x0003, "E"), rational(0x0004, 0, 6, 0),
+		{tag: 0x0005, kind: 1, count: 1}, rational(0x0006, 0)}
+
+	ifd0Offset := uint32(8)
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exif)
+	ifd0[4].value = exifOffset
+	ifd0[5].value = gpsOffset
+
+	var b bytes.Buffer
+	b.WriteString("II*\x00")
+	binary.Write(&b, binary.LittleEndian, ifd0Offset)
+	writeIFD(&b, ifd0, ifd0Offset)
+	writeIFD(&b, exif, exifOffset)
+	writeIFD(&b, gps, gpsOffset)
+	return b.Bytes()
+}
+
+// zoned returns a TIFF with the capture time, its offset when not empty and
+// a GPS IFD holding gpsTime, a "YYYY:MM:DD hh:mm:ss" time, when not empty.
+func zoned(offset, gpsTime string) []byte {
+	ifd0 := []entry{ascii(0x010f, "Leica Camera AG"), ascii(0x0110, "LEICA Q2"), {tag: 0x8769, kind: 4, count: 1}}
+	exif := []entry{ascii(0x9003, dateTimeOriginal)}
+	if offset != "" {
+		exif = append(exif, ascii(0x9011, offset))
+	}
+	var gps []entry
+	if gpsTime != "" {
+		var hour, minute, second uint32
+		fmt.Sscanf(gpsTime[11:], "%d:%d:%d", &hour, &minute, &second)
+		gps = []entry{rational(0x0007, hour, minute, second), ascii(0x001d, gpsTime[:10])}
+		ifd0 = append(ifd0, entry{tag: 0x8825, kind: 4, count: 1})
+	}
+
+	ifd0Offset := uint32(8)
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exif)
+	ifd0[2].value = exifOffset
+	if gps != nil {
+		ifd0[3].value = gpsOffset
+	}
+
+	var b bytes.Buffer
+	b.WriteString("II*\x00")
+	binary.Write(&b, binary.LittleEndian, ifd0Offset)
+	writeIFD(&b, ifd0, ifd0Offset)
+	writeIFD(&b, exif, exifOffset)
+	if gps != nil {
+		writeIFD(&b, gps, gpsOffset)
+	}
+	return b.Bytes()
+}
+
+func ifdSize(entries []entry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.data) > 4 {
+			size += uint32(len(e.data))
+		}
+	}
+	return size
+}
+
+func writeIFD(b *bytes.Buffer, entries []entry, offset uint32) {
+	dataOffset := offset + uint32(2+12*len(entries)+4)
+	var data bytes.Buffer
+	binary.Write(b, binary.LittleEndian, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(b, binary.LittleEndian, e.tag)
+		binary.Write(b, binary.LittleEndian, e.kind)
+		binary.Write(b, binary.LittleEndian, e.count)
+		switch {
+		case e.data == nil:
+			binary.Write(b, binary.LittleEndian, e.value)
+		case len(e.data) <= 4:
+			b.Write(append(e.data, make([]byte, 4-len(e.data))...))
+		default:
+			binary.Write(b, binary.LittleEndian, dataOffset+uint32(data.Len()))
+			data.Write(e.data)
+		}
+	}
+	binary.Write(b, binary.LittleEndian, uint32(0))
+	b.Write(data.Bytes())
+}
+
+func plain(tiff []byte) []byte {
+	return tiff
+}
+
+// cr2 moves IFD0 past the CR2 header, which follows the TIFF header.
+func cr2(tiff []byte) []byte {
+	out := shift(tiff, 8)
+	copy(out[8:], []byte{'C', 'R', 2, 0})
+	return out
+}
+
+// shift rebuilds the TIFF with every IFD offset moved by delta bytes.
+func shift(tiff []byte, delta uint32) []byte {
+	out := append(append([]byte{}, tiff[:8]...), make([]byte, delta)...)
+	out = append(out, tiff[8:]...)
+	binary.LittleEndian.PutUint32(out[4:], binary.LittleEndian.Uint32(tiff[4:])+delta)
+	for ifd := binary.LittleEndian.Uint32(out[4:]); ifd != 0; {
+		count := int(binary.LittleEndian.Uint16(out[ifd:]))
+		next := uint32(0)
+		for i := range count {
+			e := out[int(ifd)+2+12*i:]
+			tag := binary.LittleEndian.Uint16(e)
+			size := binary.LittleEndian.Uint32(e[4:])
+			if tag == 0x8769 {
+				next = binary.LittleEndian.Uint32(e[8:]) + delta
+				binary.LittleEndian.PutUint32(e[8:], next)
+			} else if size > 4 {
+				binary.LittleEndian.PutUint32(e[8:], binary.LittleEndian.Uint32(e[8:])+delta)
+			}
+		}
+		ifd = next
+	}
+	return out
+}
+
+// rw2 replaces the TIFF header with the Panasonic one, which is 24 bytes long.
+func rw2(tiff []byte) []byte {
+	out := shift(tiff, 16)
+	copy(out, []byte{'I', 'I', 'U', 0, 0x18, 0, 0, 0, 0x88, 0xe7, 0x74, 0xd8, 0xf8, 0x25, 0x1d, 0x4d, 0x94, 0x7a, 0x6e, 0x77, 0x82, 0x2b, 0x5d, 0x6a})
+	return out
+}
+
+func orf(tiff []byte) []byte {
+	return append([]byte("IIRO"), tiff[4:]...)
+}
+
+func jpeg(tiff []byte) []byte {
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xff, 0xd8, 0xff, 0xe1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(app1)+2))
+	out = append(out, app1...)
+	// the metadata library stops at the quantization table, as real files have one
+	dqt := append([]byte{0xff, 0xdb, 0, 67, 0}, bytes.Repeat([]byte{1}, 64)...)
+	out = append(out, dqt...)
+	return append(out, 0xff, 0xd9)
+}
+
+// heic is an ftyp box followed by the EXIF item data, which is what the
+// metadata library scans for.
+func heic(tiff []byte) []byte {
+	ftyp := []byte{0, 0, 0, 0x18, 'f', 't', 'y', 'p', 'h', 'e', 'i', 'c', 0, 0, 0, 0, 'm', 'i', 'f', '1', 'h', 'e', 'i', 'c'}
+	mdat := append([]byte{0, 0, 0, 6}, []byte("Exif\x00\x00")...)
+	mdat = append(mdat, tiff...)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(mdat)))
+	box = append(append(box, 'm', 'd', 'a', 't'), mdat...)
+	return append(ftyp, box...)
+}
+
+// raf is the RAF header pointing at an embedded JPEG preview.
+func raf(tiff []byte) []byte {
+	preview := jpeg(tiff)
+	header := make([]byte, 100)
+	copy(header, "FUJIFILMCCD-RAW 0201FF383501")
+	binary.BigEndian.PutUint32(header[84:], uint32(len(header)))
+	binary.BigEndian.PutUint32(header[88:], uint32(len(preview)))
+	return append(header, preview...)
+}
@@ -0,0 +1,35 @@
+package images
+
+import (
+	"strconv"
+
+	"github.com/downing/media-manager/pkg/xmpfile"
+)
+
+// xmpBasicNamespace is the namespace of xmp:Rating and xmp:Label.
+const xmpBasicNamespace = "http://ns.adobe.com/xap/1.0/"
+
+// Labels are the rating and color label an editor such as Lightroom gave a
+// photo. Rating is 0 when the photo is unrated, HasRating tells an unrated
+// photo from XMP that has no rating at all.
+type Labels struct {
+	Rating    int
+	HasRating bool
+	Label     string
+}
+
+// ReadLabels reads the labels from the photo's XMP sidecar, or else from the
+// XMP embedded in the file.
+func ReadLabels(path string) (Labels, bool) {
+	var labels Labels
+	found := xmpfile.Find(path, func(p xmpfile.Packet) bool {
+		labels = Labels{Label: p.Basic.Label}
+		// read here as the XMP parser reads every positive rating as 0
+		if value, ok := p.Value(xmpBasicNamespace, "Rating"); ok {
+			rating, err := strconv.Atoi(value)
+			labels.Rating, labels.HasRating = rating, err == nil
+		}
+		return true
+	})
+	return labels, found
+}
@@ -0,0 +1,51 @@
+package images
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadLabels(t *testing.T) {
+	const packet = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/"%s>%s</rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+	tests := []struct {
+		name  string
+		attrs string
+		body  string
+		want  Labels
+	}{
+		{"rated", ` xmp:Rating="3" xmp:Label="Red"`, "", Labels{Rating: 3, HasRating: true, Label: "Red"}},
+		{"rating cleared", ` xmp:Rating="0"`, "", Labels{Rating: 0, HasRating: true}},
+		{"rejected", ` xmp:Rating="-1"`, "", Labels{Rating: -1, HasRating: true}},
+		{"rating as an element", "", "<xmp:Rating>4</xmp:Rating>", Labels{Rating: 4, HasRating: true}},
+		{"no rating", ` xmp:Label="Green"`, "", Labels{Label: "Green"}},
+		{"rating in another namespace", ` xmlns:other="urn:other" other:Rating="4"`, "", Labels{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			photo := filepath.Join(dir, "IMG_0001.CR2")
+			if err := os.WriteFile(photo, []byte("raw"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			sidecar := filepath.Join(dir, "IMG_0001.xmp")
+			if err := os.WriteFile(sidecar, []byte(fmt.Sprintf(packet, tt.attrs, tt.body)), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			labels, ok := ReadLabels(photo)
+			if !ok {
+				t.Fatal("ReadLabels() found no XMP")
+			}
+			if labels != tt.want {
+				t.Errorf("ReadLabels() = %+v, want %+v", labels, tt.want)
+			}
+		})
+	}
+}
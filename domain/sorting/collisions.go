@@ -0,0 +1,237 @@
+package sorting
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	CollisionSkipIfIdentical = "skip-if-identical"
+	CollisionSuffix          = "suffix"
+	CollisionError           = "error"
+	CollisionOverwrite       = "overwrite"
+
+	// maxCollisionSuffix bounds the numbered names tried for one file.
+	maxCollisionSuffix = 999
+)
+
+// reservations are the destinations claimed by files earlier in the same run,
+// so two files never get the same destination before either is written.
+type reservations struct {
+	mu    sync.Mutex
+	paths map[string]string
+}
+
+func newReservations() *reservations {
+	return &reservations{paths: map[string]string{}}
+}
+
+// occupant returns the file already at path, or the file of this run that has
+// claimed it. When there is none, path is claimed for file.
+func (s *Service) occupant(r *reservations, path, file string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if owner, ok := r.paths[path]; ok && owner != file {
+		return owner, nil
+	}
+	exists, err := s.files.DoesFileExist(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if file exists at destination [%s]: %w", path, err)
+	}
+	if exists {
+		return path, nil
+	}
+	r.paths[path] = file
+	return "", nil
+}
+
+func (r *reservations) release(paths []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, path := range paths {
+		delete(r.paths, path)
+	}
+}
+
+// resolveCollision places the job's files at their destinations. Files with
+// identical content already there are not transferred again and a changed
+// sidecar is replaced. Any other different file is handled by the collision
+// policy, which renames, skips or fails the whole group so it stays together.
+func (s *Service) resolveCollision(op operation, j *job) {
+	base := j.destPath
+	fixed := j.present
+	for n := 0; n <= maxCollisionSuffix; n++ {
+		candidate := base
+		if n > 0 {
+			candidate = suffixedPath(base, n)
+		}
+
+		conflict, claimed, err := s.placeGroup(op.reservations, j, candidate, fixed)
+		if err != nil {
+			j.err = err
+			return
+		}
+		if conflict == "" {
+			if n > 0 {
+				s.logger.Info("Destination collision resolved", zap.String("file", j.file), zap.String("dest_path", base),
+					zap.String("policy", CollisionSuffix), zap.String("resolution", "renamed to "+candidate))
+			}
+			return
+		}
+		op.reservations.release(claimed)
+
+		switch {
+		case s.criteria.Collisions == CollisionSkipIfIdentical:
+			j.skipReason = "different file already at destination"
+			s.logger.Warn("Destination collision resolved", zap.String("file", j.file), zap.String("dest_path", conflict),
+				zap.String("policy", CollisionSkipIfIdentical), zap.String("resolution", "skipped, existing file kept"))
+			return
+		case s.criteria.Collisions == CollisionError:
+			j.err = fmt.Errorf("different file already at destination [%s] for file [%s]", conflict, j.file)
+			return
+		case fixed:
+			j.err = fmt.Errorf("different file already at destination [%s] for file [%s], its group is already at [%s] and cannot be renamed", conflict, j.file, j.destPath)
+			return
+		}
+	}
+	j.err = fmt.Errorf("no free destination for file [%s] after %d numbered names of [%s]", j.file, maxCollisionSuffix, base)
+}
+
+// placeGroup tries the group at a candidate destination for the primary file,
+// or at the primary's existing destination when it is fixed. It returns the
+// destination of the first file in the way, if any, and the destinations it
+// claimed.
+func (s *Service) placeGroup(r *reservations, j *job, candidate string, fixed bool) (string, []string, error) {
+	claimed := []string{}
+	if !fixed {
+		j.destPath = candidate
+		conflict, present, checksum, err := s.placeFile(r, j.file, candidate, false, &claimed)
+		if err != nil || conflict != "" {
+			return conflict, claimed, err
+		}
+		j.present = present
+		if present {
+			j.checksum = checksum
+		}
+	}
+
+	for _, c := range j.companions {
+		c.destPath = companionDestPath(j.destPath, j.file, c.file)
+		conflict, present, checksum, err := s.placeFile(r, c.file, c.destPath, c.sidecar, &claimed)
+		if err != nil || conflict != "" {
+			return conflict, claimed, err
+		}
+		c.present = present
+		if present {
+			c.checksum = checksum
+		}
+	}
+	return "", claimed, nil
+}
+
+// placeFile checks one file against what is at, or claimed for, its
+// destination. It reports a conflict, or whether an identical copy is already
+// there and its checksum.
+func (s *Service) placeFile(r *reservations, file, destPath string, sidecar bool, claimed *[]string) (string, bool, string, error) {
+	other, err := s.occupant(r, destPath, file)
+	if err != nil {
+		return "", false, "", err
+	}
+	if other == "" {
+		*claimed = append(*claimed, destPath)
+		return "", false, "", nil
+	}
+
+	identical, checksum, err := s.sameContent(file, other)
+	if err != nil {
+		return "", false, "", err
+	}
+	if identical {
+		return "", true, checksum, nil
+	}
+
+	// files of this run are never overwritten by each other
+	if other == destPath && (sidecar || s.criteria.Collisions == CollisionOverwrite) {
+		resolution := "overwriting existing file"
+		if sidecar {
+			resolution = "replacing changed sidecar"
+		}
+		s.logger.Info("Destination collision resolved", zap.String("file", file), zap.String("dest_path", destPath),
+			zap.String("policy", s.criteria.Collisions), zap.String("resolution", resolution))
+		return "", false, "", nil
+	}
+	return destPath, false, "", nil
+}
+
+// checkPlannedFile checks the destination of a planned file has not been taken
+// by a different file since planning. It reports whether an identical copy is
+// already there and its checksum.
+func (s *Service) checkPlannedFile(file, destPath string, sidecar bool) (bool, string, error) {
+	exists, err := s.files.DoesFileExist(destPath)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check if file exists at destination [%s]: %w", destPath, err)
+	}
+	if !exists {
+		return false, "", nil
+	}
+
+	identical, checksum, err := s.sameContent(file, destPath)
+	if err != nil {
+		return false, "", err
+	}
+	if !identical && !sidecar && s.criteria.Collisions != CollisionOverwrite {
+		return false, "", fmt.Errorf("different file at destination [%s] since the plan was made", destPath)
+	}
+	return identical, checksum, nil
+}
+
+// sameContent reports whether two files hold the same bytes, comparing sizes
+// before checksums, and returns the checksum when they do.
+func (s *Service) sameContent(pathA, pathB string) (bool, string, error) {
+	infoA, err := s.files.GetFileInfo(pathA)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get file info for file [%s]: %w", pathA, err)
+	}
+	infoB, err := s.files.GetFileInfo(pathB)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get file info for file [%s]: %w", pathB, err)
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, "", nil
+	}
+
+	checksumA, err := s.contentChecksum(pathA)
+	if err != nil {
+		return false, "", err
+	}
+	checksumB, err := s.contentChecksum(pathB)
+	if err != nil {
+		return false, "", err
+	}
+	return checksumA == checksumB, checksumA, nil
+}
+
+// contentChecksum returns the checksum of the file from the hash index, hashing it when it is not indexed.
+func (s *Service) contentChecksum(path string) (string, error) {
+	if s.index != nil {
+		if checksum := s.index.checksum(path); checksum != "" {
+			return checksum, nil
+		}
+	}
+	checksum, err := s.files.HashFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file [%s]: %w", path, err)
+	}
+	return checksum, nil
+}
+
+// suffixedPath numbers a destination, IMG_0001.CR3 becomes IMG_0001_1.CR3.
+func suffixedPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
@@ -0,0 +1,134 @@
+package sorting
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCollisionsFollowJobOrder imports pairs of files that want the same
+// destination with several prepare workers. The first file of each pair in
+// job order is the slower one to read, yet must keep the plain name.
+func TestCollisionsFollowJobOrder(t *testing.T) {
+	s, _, trees := newTestService(t, SortCriteria{ReadJobs: 8, WriteJobs: 4})
+	first := strings.Repeat("first ", 200_000)
+	names := []string{}
+	for i := range 20 {
+		name := fmt.Sprintf("IMG_20230714_0930%02d.jpg", i)
+		names = append(names, name)
+		writeFile(t, filepath.Join(trees.raw, fmt.Sprintf("%02d", i), "a", name), first)
+		writeFile(t, filepath.Join(trees.raw, fmt.Sprintf("%02d", i), "b", name), "second")
+	}
+
+	if err := s.ImportRawFiles(context.Background()); err != nil {
+		t.Fatalf("ImportRawFiles() error = %v", err)
+	}
+
+	for _, name := range names {
+		if got := readFile(t, filepath.Join(trees.localRaw, "2023", name)); got != first {
+			t.Errorf("%s holds the second file of its pair, want the first", name)
+		}
+		if got := readFile(t, filepath.Join(trees.localRaw, "2023", suffixedPath(name, 1))); got != "second" {
+			t.Errorf("%s holds the first file of its pair, want the second", suffixedPath(name, 1))
+		}
+	}
+}
+
+func TestCollisionPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		// sources are imported, existing is already at the destination, both by file name
+		sources  map[string]string
+		existing map[string]string
+		// want is what the destination holds afterwards, "" for no file
+		want        map[string]string
+		wantFailure bool
+	}{
+		{
+			name:     "suffix renames",
+			policy:   CollisionSuffix,
+			sources:  map[string]string{"IMG_20230714_093015.jpg": "photo"},
+			existing: map[string]string{"IMG_20230714_093015.jpg": "other"},
+			want:     map[string]string{"IMG_20230714_093015.jpg": "other", "IMG_20230714_093015_1.jpg": "photo"},
+		},
+		{
+			name:     "skip if identical keeps the existing file",
+			policy:   CollisionSkipIfIdentical,
+			sources:  map[string]string{"IMG_20230714_093015.jpg": "photo"},
+			existing: map[string]string{"IMG_20230714_093015.jpg": "other"},
+			want:     map[string]string{"IMG_20230714_093015.jpg": "other", "IMG_20230714_093015_1.jpg": ""},
+		},
+		{
+			name:        "error fails the file",
+			policy:      CollisionError,
+			sources:     map[string]string{"IMG_20230714_093015.jpg": "photo"},
+			existing:    map[string]string{"IMG_20230714_093015.jpg": "other"},
+			want:        map[string]string{"IMG_20230714_093015.jpg": "other", "IMG_20230714_093015_1.jpg": ""},
+			wantFailure: true,
+		},
+		{
+			name:     "overwrite replaces",
+			policy:   CollisionOverwrite,
+			sources:  map[string]string{"IMG_20230714_093015.jpg": "photo"},
+			existing: map[string]string{"IMG_20230714_093015.jpg": "other"},
+			want:     map[string]string{"IMG_20230714_093015.jpg": "photo", "IMG_20230714_093015_1.jpg": ""},
+		},
+		{
+			name:     "identical file is not a collision",
+			policy:   CollisionError,
+			sources:  map[string]string{"IMG_20230714_093015.jpg": "photo"},
+			existing: map[string]string{"IMG_20230714_093015.jpg": "photo"},
+			want:     map[string]string{"IMG_20230714_093015.jpg": "photo", "IMG_20230714_093015_1.jpg": ""},
+		},
+		{
+			name:     "changed sidecar is replaced",
+			policy:   CollisionError,
+			sources:  map[string]string{"IMG_20230714_093015.cr2": "raw", "IMG_20230714_093015.xmp": "new edit"},
+			existing: map[string]string{"IMG_20230714_093015.cr2": "raw", "IMG_20230714_093015.xmp": "old edit"},
+			want: map[string]string{"IMG_20230714_093015.cr2": "raw", "IMG_20230714_093015.xmp": "new edit",
+				"IMG_20230714_093015_1.cr2": "", "IMG_20230714_093015_1.xmp": ""},
+		},
+		{
+			name:     "suffix renames the group together",
+			policy:   CollisionSuffix,
+			sources:  map[string]string{"IMG_20230714_093015.cr2": "raw", "IMG_20230714_093015.jpg": "jpeg"},
+			existing: map[string]string{"IMG_20230714_093015.jpg": "other jpeg"},
+			want: map[string]string{"IMG_20230714_093015.cr2": "", "IMG_20230714_093015.jpg": "other jpeg",
+				"IMG_20230714_093015_1.cr2": "raw", "IMG_20230714_093015_1.jpg": "jpeg"},
+		},
+		{
+			name:     "skip if identical skips the group together",
+			policy:   CollisionSkipIfIdentical,
+			sources:  map[string]string{"IMG_20230714_093015.cr2": "raw", "IMG_20230714_093015.jpg": "jpeg"},
+			existing: map[string]string{"IMG_20230714_093015.jpg": "other jpeg"},
+			want:     map[string]string{"IMG_20230714_093015.cr2": "", "IMG_20230714_093015.jpg": "other jpeg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, trees := newTestService(t, SortCriteria{Collisions: tt.policy})
+			for name, content := range tt.sources {
+				writeFile(t, filepath.Join(trees.raw, name), content)
+			}
+			for name, content := range tt.existing {
+				writeFile(t, filepath.Join(trees.localRaw, "2023", name), content)
+			}
+
+			if err := s.ImportRawFiles(context.Background()); err != nil {
+				t.Fatalf("ImportRawFiles() error = %v", err)
+			}
+
+			for name, want := range tt.want {
+				if got := readFile(t, filepath.Join(trees.localRaw, "2023", name)); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if failures := s.Failures(); (len(failures) != 0) != tt.wantFailure {
+				t.Errorf("Failures() = %+v, want failure %v", failures, tt.wantFailure)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package sorting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"go.uber.org/zap"
+)
+
+const (
+	DuplicatesSkip     = "skip"
+	DuplicatesHardlink = "hardlink"
+	DuplicatesOff      = "off"
+)
+
+// DuplicateCluster is a set of byte-identical files in the media trees.
+type DuplicateCluster struct {
+	Checksum string
+	Size     int64
+	Paths    []string
+}
+
+// hashIndex maps content checksums to the files in the media trees that hold them.
+type hashIndex struct {
+	mu         sync.RWMutex
+	byPath     map[string]catalog.FileHash
+	byChecksum map[string][]string
+}
+
+func newHashIndex() *hashIndex {
+	return &hashIndex{
+		byPath:     map[string]catalog.FileHash{},
+		byChecksum: map[string][]string{},
+	}
+}
+
+func (x *hashIndex) add(hash catalog.FileHash) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(hash.Path)
+	x.byPath[hash.Path] = hash
+	x.byChecksum[hash.Checksum] = append(x.byChecksum[hash.Checksum], hash.Path)
+}
+
+func (x *hashIndex) remove(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(path)
+}
+
+func (x *hashIndex) removeLocked(path string) {
+	hash, ok := x.byPath[path]
+	if !ok {
+		return
+	}
+	delete(x.byPath, path)
+	paths := x.byChecksum[hash.Checksum]
+	for i, p := range paths {
+		if p == path {
+			x.byChecksum[hash.Checksum] = append(paths[:i:i], paths[i+1:]...)
+			break
+		}
+	}
+}
+
+// checksum returns the content checksum of the file, or "" if it is not indexed.
+func (x *hashIndex) checksum(path string) string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.byPath[path].Checksum
+}
+
+// copiesUnder returns the indexed files under root with the given checksum, in path order.
+func (x *hashIndex) copiesUnder(checksum, root string) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	copies := []string{}
+	for _, path := range x.byChecksum[checksum] {
+		if isUnder(path, root) {
+			copies = append(copies, path)
+		}
+	}
+	sort.Strings(copies)
+	return copies
+}
+
+// clusters returns every checksum held by more than one file.
+func (x *hashIndex) clusters() []DuplicateCluster {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	clusters := []DuplicateCluster{}
+	for checksum, paths := range x.byChecksum {
+		if len(paths) < 2 {
+			continue
+		}
+		sorted := append([]string{}, paths...)
+		sort.Strings(sorted)
+		clusters = append(clusters, DuplicateCluster{
+			Checksum: checksum,
+			Size:     x.byPath[sorted[0]].Size,
+			Paths:    sorted,
+		})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Paths[0] < clusters[j].Paths[0]
+	})
+	return clusters
+}
+
+// FindDuplicates indexes the contents of the raw, local raw, local edited and
+// backup paths and returns every set of byte-identical files. Hashes cached in
+// the catalog are reused but new ones are not saved, as the catalog is only
+// read so the search works while another run has it open.
+func (s *Service) FindDuplicates(ctx context.Context) ([]DuplicateCluster, error) {
+	roots, err := s.existingRoots(s.criteria.RawPath, s.criteria.LocalRawPath, s.criteria.LocalEditedPath, s.criteria.BackupPath)
+	if err != nil {
+		return nil, err
+	}
+	index, err := s.loadHashIndex(ctx, roots, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	s.index = index
+
+	clusters := index.clusters()
+	s.logger.Info("Duplicate search completed", zap.Int("cluster_count", len(clusters)))
+	return clusters, nil
+}
+
+// loadHashIndex hashes the media files in the roots and the given files,
+// reusing the catalogued checksum of files whose size and modification time
+// are unchanged. When persist is set the result is saved in the catalog and
+// the hashes of files gone from the roots are removed. Files that cannot be
+// read are left out.
+func (s *Service) loadHashIndex(ctx context.Context, roots, files []string, persist bool) (*hashIndex, error) {
+	cached := map[string]catalog.FileHash{}
+	err := s.catalog.Hashes(func(hash catalog.FileHash) error {
+		cached[hash.Path] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file hashes: %w", err)
+	}
+
+	jobs := []*job{}
+	seen := map[string]bool{}
+	addFiles := func(files []string) {
+		for _, file := range files {
+			if seen[file] || !fileTypeIsInList(file, s.criteria.FileTypes) && !isSidecar(file) {
+				continue
+			}
+			seen[file] = true
+			jobs = append(jobs, &job{index: len(jobs), file: file})
+		}
+	}
+	for _, root := range roots {
+		rootFiles, err := s.files.GetFilesRecursivelyInPath(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files recursively in path [%s]: %w", root, err)
+		}
+		addFiles(rootFiles)
+	}
+	addFiles(files)
+	s.logger.Info("Indexing media file contents", zap.Strings("paths", roots), zap.Int("file_count", len(jobs)))
+
+	index := newHashIndex()
+	updated := []catalog.FileHash{}
+	err = s.process(ctx, jobs,
+		func(j *job) {
+			info, err := s.files.GetFileInfo(j.file)
+			if err != nil {
+				j.err = fmt.Errorf("failed to get file info for file [%s]: %w", j.file, err)
+				return
+			}
+			j.entry = catalog.Entry{SourcePath: j.file, Size: info.Size(), ModTime: info.ModTime()}
+
+			hash, ok := cached[j.file]
+			if ok && j.entry.Matches(hash.Size, hash.ModTime) {
+				j.checksum = hash.Checksum
+				return
+			}
+			j.checksum, j.err = s.files.HashFile(j.file)
+			if j.err != nil {
+				j.err = fmt.Errorf("failed to hash file [%s]: %w", j.file, j.err)
+			}
+		},
+		func(*job) {},
+		func(*job) {},
+		func(j *job, _ int) error {
+			if errors.Is(j.err, context.Canceled) {
+				return nil
+			}
+			if j.err != nil {
+				s.logger.Warn("Failed to index file contents, file left out of the index", zap.String("file", j.file), zap.Error(j.err))
+				return nil
+			}
+			hash := catalog.FileHash{Path: j.file, Size: j.entry.Size, ModTime: j.entry.ModTime, Checksum: j.checksum}
+			old, ok := cached[j.file]
+			if !ok || !j.entry.Matches(old.Size, old.ModTime) || old.Checksum != j.checksum {
+				updated = append(updated, hash)
+			}
+			index.add(hash)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !persist {
+		s.logger.Info("Indexed media file contents", zap.Int("hashed_count", len(updated)))
+		return index, nil
+	}
+
+	stale := []string{}
+	for path := range cached {
+		if !seen[path] && isUnderAny(path, roots) {
+			stale = append(stale, path)
+		}
+	}
+
+	if err := s.catalog.PutHashes(updated); err != nil {
+		return nil, err
+	}
+	if err := s.catalog.DeleteHashes(stale); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Indexed media file contents", zap.Int("hashed_count", len(updated)), zap.Int("removed_count", len(stale)))
+	return index, nil
+}
+
+// existingRoots returns the paths that are set and exist, leaving out any
+// under an earlier one.
+func (s *Service) existingRoots(paths ...string) ([]string, error) {
+	roots := []string{}
+	for _, root := range paths {
+		if root == "" || isUnderAny(root, roots) {
+			continue
+		}
+		exists, err := s.files.DoesPathExist(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if path exists [%s]: %w", root, err)
+		}
+		if exists {
+			roots = append(roots, filepath.Clean(root))
+		}
+	}
+	return roots, nil
+}
+
+// markDuplicateJobs, when duplicates are handled, indexes the operation's
+// destination tree and the files of its jobs and marks every job whose content
+// matches an earlier job in the same run. A planned operation does not save the
+// index in the catalog.
+func (s *Service) markDuplicateJobs(ctx context.Context, op operation, jobs []*job) error {
+	if s.criteria.Duplicates == DuplicatesOff || op.manifestRoot == "" {
+		return nil
+	}
+	roots, err := s.existingRoots(op.manifestRoot)
+	if err != nil {
+		return err
+	}
+	files := []string{}
+	for _, j := range jobs {
+		files = append(files, j.file)
+		for _, c := range j.companions {
+			files = append(files, c.file)
+		}
+	}
+	index, err := s.loadHashIndex(ctx, roots, files, !op.plan)
+	if err != nil {
+		return err
+	}
+	s.index = index
+
+	first := map[string]string{}
+	for _, j := range jobs {
+		if len(j.companions) > 0 {
+			continue
+		}
+		checksum := s.index.checksum(j.file)
+		if checksum == "" {
+			continue
+		}
+		if file, ok := first[checksum]; ok {
+			j.duplicateOf = file
+			continue
+		}
+		first[checksum] = j.file
+	}
+	return nil
+}
+
+// checkDuplicate skips or links a file whose content is already in the
+// operation's destination tree, or earlier in the same run. A group is only
+// skipped when every file in it is a duplicate, and is never linked.
+func (s *Service) checkDuplicate(op operation, j *job) {
+	if s.index == nil || s.criteria.Duplicates == DuplicatesOff || op.manifestRoot == "" || j.present {
+		return
+	}
+	checksum := s.index.checksum(j.file)
+	if checksum == "" {
+		return
+	}
+	copies := s.index.copiesUnder(checksum, op.manifestRoot)
+	if slices.Contains(copies, j.destPath) {
+		// the file is already at its own destination, placing finds it present
+		return
+	}
+	if len(copies) == 0 {
+		if j.duplicateOf != "" {
+			j.skipReason = "duplicate of " + j.duplicateOf + " in this run"
+		}
+		return
+	}
+
+	for _, c := range j.companions {
+		if len(s.index.copiesUnder(s.index.checksum(c.file), op.manifestRoot)) == 0 {
+			return
+		}
+	}
+
+	j.checksum = checksum
+	j.duplicatePath = copies[0]
+	if s.criteria.Duplicates == DuplicatesHardlink && len(j.companions) == 0 {
+		j.action = ActionLink
+		return
+	}
+	j.skipReason = "duplicate of " + copies[0]
+}
+
+// indexTransfer keeps the hash index and the catalogued hashes in step with a
+// completed transfer. Nothing is indexed for a planned operation.
+func (s *Service) indexTransfer(op operation, action, file, destPath string, entry catalog.Entry, checksum string) error {
+	if op.plan || s.index == nil || checksum == "" {
+		return nil
+	}
+
+	hash := catalog.FileHash{Path: destPath, Size: entry.Size, ModTime: entry.ModTime, Checksum: checksum}
+	if err := s.catalog.PutHashes([]catalog.FileHash{hash}); err != nil {
+		return err
+	}
+	s.index.add(hash)
+
+	if action == ActionMove {
+		if err := s.catalog.DeleteHashes([]string{file}); err != nil {
+			return err
+		}
+		s.index.remove(file)
+	}
+	return nil
+}
+
+func isUnder(path, root string) bool {
+	root = filepath.Clean(root)
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+func isUnderAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if isUnder(path, root) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package sorting
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/downing/media-manager/domain/catalog"
+)
+
+// TestDuplicateAtOwnDestination imports a file that is not in the catalog
+// but already sits at its destination, as after losing the catalog. It is
+// recorded there, not linked to or skipped as a duplicate of itself.
+func TestDuplicateAtOwnDestination(t *testing.T) {
+	for _, mode := range []string{DuplicatesSkip, DuplicatesHardlink} {
+		t.Run(mode, func(t *testing.T) {
+			s, store, trees := newTestService(t, SortCriteria{Duplicates: mode})
+			source := filepath.Join(trees.raw, "IMG_20230714_093015.jpg")
+			dest := filepath.Join(trees.localRaw, "2023", "IMG_20230714_093015.jpg")
+			writeFile(t, source, "photo")
+			writeFile(t, dest, "photo")
+
+			actions, err := s.PlanImportRawFiles(context.Background())
+			if err != nil {
+				t.Fatalf("PlanImportRawFiles() error = %v", err)
+			}
+			if len(actions) != 1 || actions[0].Action != ActionSkip || actions[0].Reason != "identical file already at destination" {
+				t.Errorf("PlanImportRawFiles() = %+v, want a skip as already at destination", actions)
+			}
+
+			if err := s.ImportRawFiles(context.Background()); err != nil {
+				t.Fatalf("ImportRawFiles() error = %v", err)
+			}
+			if failures := s.Failures(); len(failures) != 0 {
+				t.Fatalf("Failures() = %+v, want none", failures)
+			}
+
+			entry, found := catalogEntry(t, store, source)
+			if !found || entry.DestinationPath(catalog.KindImport) != dest {
+				t.Errorf("catalog entry = %+v, want the file recorded at %s", entry, dest)
+			}
+			if got := readFile(t, dest); got != "photo" {
+				t.Errorf("destination = %q, want %q", got, "photo")
+			}
+		})
+	}
+}
+
+// TestDuplicateElsewhere skips or links a file whose content is already in
+// the destination tree under another name.
+func TestDuplicateElsewhere(t *testing.T) {
+	tests := []struct {
+		mode   string
+		linked bool
+	}{
+		{DuplicatesSkip, false},
+		{DuplicatesHardlink, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s, _, trees := newTestService(t, SortCriteria{Duplicates: tt.mode})
+			writeFile(t, filepath.Join(trees.raw, "IMG_20230714_093015.jpg"), "photo")
+			writeFile(t, filepath.Join(trees.localRaw, "2022", "copy.jpg"), "photo")
+
+			if err := s.ImportRawFiles(context.Background()); err != nil {
+				t.Fatalf("ImportRawFiles() error = %v", err)
+			}
+			got := readFile(t, filepath.Join(trees.localRaw, "2023", "IMG_20230714_093015.jpg"))
+			if linked := got == "photo"; linked != tt.linked {
+				t.Errorf("linked = %v, want %v", linked, tt.linked)
+			}
+		})
+	}
+}
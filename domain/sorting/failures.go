@@ -0,0 +1,107 @@
+package sorting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	runtimestats "github.com/downing/media-manager/pkg/runtime_stats"
+	"go.uber.org/zap"
+)
+
+const (
+	StagePrepare  = "prepare"
+	StageTransfer = "transfer"
+	StageVerify   = "verify"
+)
+
+// FailureReport lists the files a run could not process, it can be saved as
+// JSON and retried later.
+type FailureReport struct {
+	CreatedAt time.Time `json:"created_at"`
+	Failures  []Failure `json:"failures"`
+}
+
+// Failure is one file, with the companions of its group, that failed in an
+// operation. Stage is the pipeline stage it failed in and Cause the error.
+type Failure struct {
+	Operation  string    `json:"operation"`
+	File       string    `json:"file"`
+	Companions []string  `json:"companions,omitempty"`
+	Stage      string    `json:"stage"`
+	Cause      string    `json:"cause"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+// Failures returns the files that have failed so far, in the order they failed.
+func (s *Service) Failures() []Failure {
+	return append([]Failure{}, s.failures...)
+}
+
+// RetryFailures runs each failed file again through the operation it failed
+// in, leaving every other file alone.
+func (s *Service) RetryFailures(ctx context.Context, failures []Failure) error {
+	order := []string{}
+	files := map[string]map[string]bool{}
+	for _, failure := range failures {
+		if _, ok := files[failure.Operation]; !ok {
+			order = append(order, failure.Operation)
+			files[failure.Operation] = map[string]bool{}
+		}
+		files[failure.Operation][failure.File] = true
+	}
+
+	for _, kind := range order {
+		op, err := s.operationForKind(kind)
+		if err != nil {
+			return err
+		}
+		op.only = files[kind]
+
+		s.logger.Info("Retrying failed files for "+op.name, zap.Int("file_count", len(op.only)))
+		transferred, err := s.run(ctx, op)
+		if err != nil {
+			return err
+		}
+		s.logger.Info("Retry of failed files for "+op.name+" completed", zap.Int("file_count", transferred))
+	}
+	return nil
+}
+
+// fail records a job that could not be processed, so the run can carry on
+// with the next file.
+func (s *Service) fail(op operation, j *job, stage string) {
+	s.logger.Error("File failed, continuing with the next file", zap.String("operation", op.kind), zap.String("file", j.file),
+		zap.String("stage", stage), zap.Error(j.err))
+
+	failure := Failure{
+		Operation: op.kind,
+		File:      j.file,
+		Stage:     stage,
+		Cause:     j.err.Error(),
+		FailedAt:  time.Now(),
+	}
+	for _, c := range j.companions {
+		failure.Companions = append(failure.Companions, c.file)
+	}
+	s.failures = append(s.failures, failure)
+	s.stats.IncrementCounter(runtimestats.FilesFailed)
+}
+
+// WriteFailureReport writes the report as JSON that ReadFailureReport can load.
+func WriteFailureReport(w io.Writer, report FailureReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// ReadFailureReport loads a report written by WriteFailureReport.
+func ReadFailureReport(r io.Reader) (FailureReport, error) {
+	var report FailureReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return FailureReport{}, fmt.Errorf("failed to decode failure report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,58 @@
+package sorting
+
+import (
+	"path/filepath"
+
+	"github.com/downing/media-manager/domain/filters"
+	"github.com/downing/media-manager/domain/images"
+	"go.uber.org/zap"
+)
+
+// checkFilter matches the job's primary file against the operation's filter
+// rules, skipping the group when it is excluded. media is only called when a
+// rule needs the file's metadata.
+func (s *Service) checkFilter(op operation, j *job, media func() resolvedMedia) {
+	filter := s.criteria.Filters[op.kind]
+	if filter == nil {
+		return
+	}
+
+	rel, err := filepath.Rel(op.sourcePath, j.file)
+	if err != nil {
+		rel = j.file
+	}
+	included, reason := filter.Match(filters.File{
+		Path:    filepath.ToSlash(rel),
+		Size:    j.entry.Size,
+		Details: func() filters.Details { return fileDetails(media()) },
+	})
+	if reason != "" {
+		s.logger.Debug("Filter rule matched", zap.String("file", j.file), zap.String("operation", op.name),
+			zap.Bool("included", included), zap.String("rule", reason))
+	}
+	if !included {
+		j.skipReason = "filtered out, " + reason
+		j.excluded = true
+	}
+}
+
+// fileDetails are what filter rules match besides the path and size. A
+// rating in the XMP, where editors write it, wins over the camera's.
+func fileDetails(media resolvedMedia) filters.Details {
+	d := filters.Details{Camera: media.GetCameraModel(), Taken: media.GetTimestamp()}
+	if metadata := photoMetadata(media); metadata != nil {
+		if metadata.LensModel != nil {
+			d.Lens = *metadata.LensModel
+		}
+		if metadata.Rating != nil {
+			d.Rating = *metadata.Rating
+		}
+	}
+	if labels, ok := images.ReadLabels(media.GetFilePath()); ok {
+		if labels.HasRating {
+			d.Rating = labels.Rating
+		}
+		d.Label = labels.Label
+	}
+	return d
+}
@@ -0,0 +1,106 @@
+package sorting
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/domain/images"
+)
+
+// sidecarFileTypes are editor files that belong to a photo, such as the .xmp
+// files written by Lightroom and darktable and the .dop files written by DxO.
+var sidecarFileTypes = []string{"xmp", "dop"}
+
+// companion is a file that travels with the primary file of its group, such as
+// the JPEG of a RAW+JPEG pair or a sidecar.
+type companion struct {
+	file    string
+	sidecar bool
+
+	entry    catalog.Entry
+	destPath string
+	checksum string
+	// present means an identical copy is already at destPath.
+	present bool
+}
+
+// fileGroup is the files in one directory that share a base name.
+type fileGroup struct {
+	primary    string
+	companions []string
+}
+
+// groupFiles groups the media files with the other media files and sidecars
+// that share their directory and base name, in the order the first file of
+// each group is found. Sidecars without a media file are left out.
+func groupFiles(files, fileTypes []string) []fileGroup {
+	order := []string{}
+	members := map[string][]string{}
+	for _, file := range files {
+		if !fileTypeIsInList(file, fileTypes) && !isSidecar(file) {
+			continue
+		}
+		key := groupKey(file, fileTypes)
+		if _, ok := members[key]; !ok {
+			order = append(order, key)
+		}
+		members[key] = append(members[key], file)
+	}
+
+	groups := []fileGroup{}
+	for _, key := range order {
+		primary := primaryFile(members[key], fileTypes)
+		if primary == "" {
+			continue
+		}
+		group := fileGroup{primary: primary}
+		for _, file := range members[key] {
+			if file != primary {
+				group.companions = append(group.companions, file)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// groupKey is the directory and base name shared by a group, IMG_0001.CR3,
+// IMG_0001.JPG, IMG_0001.xmp and IMG_0001.CR3.xmp all have the same key.
+func groupKey(file string, fileTypes []string) string {
+	name := filepath.Base(file)
+	if isSidecar(name) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if fileTypeIsInList(name, fileTypes) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return filepath.Join(filepath.Dir(file), strings.ToLower(name))
+}
+
+// primaryFile picks the file whose metadata and name decide where a group
+// goes, a raw file if there is one, or "" if the group has only sidecars.
+func primaryFile(files, fileTypes []string) string {
+	var primary string
+	for _, file := range files {
+		switch {
+		case fileTypeIsInList(file, images.GetRawTypes()):
+			return file
+		case primary == "" && fileTypeIsInList(file, fileTypes):
+			primary = file
+		}
+	}
+	return primary
+}
+
+// companionDestPath places a companion next to its primary's destination,
+// keeping the companion's own extensions.
+func companionDestPath(primaryDest, primary, file string) string {
+	stem := strings.TrimSuffix(filepath.Base(primary), filepath.Ext(primary))
+	suffix := filepath.Base(file)[len(stem):]
+	return strings.TrimSuffix(primaryDest, filepath.Ext(primaryDest)) + suffix
+}
+
+func isSidecar(file string) bool {
+	return fileTypeIsInList(file, sidecarFileTypes)
+}
@@ -0,0 +1,134 @@
+package sorting
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupFiles(t *testing.T) {
+	fileTypes := []string{"cr3", "cr2", "jpg", "mp4"}
+	tests := []struct {
+		name  string
+		files []string
+		want  []fileGroup
+	}{
+		{
+			name:  "raw is the primary of a RAW+JPEG pair",
+			files: []string{"/a/IMG_0001.JPG", "/a/IMG_0001.CR3"},
+			want:  []fileGroup{{primary: "/a/IMG_0001.CR3", companions: []string{"/a/IMG_0001.JPG"}}},
+		},
+		{
+			name:  "sidecars of either naming join the group",
+			files: []string{"/a/IMG_0001.CR3", "/a/IMG_0001.xmp", "/a/IMG_0001.CR3.xmp", "/a/IMG_0001.CR3.dop"},
+			want: []fileGroup{{primary: "/a/IMG_0001.CR3",
+				companions: []string{"/a/IMG_0001.xmp", "/a/IMG_0001.CR3.xmp", "/a/IMG_0001.CR3.dop"}}},
+		},
+		{
+			name:  "names differing in case are one group",
+			files: []string{"/a/img_0001.jpg", "/a/IMG_0001.CR2"},
+			want:  []fileGroup{{primary: "/a/IMG_0001.CR2", companions: []string{"/a/img_0001.jpg"}}},
+		},
+		{
+			name:  "sidecars without a media file are left out",
+			files: []string{"/a/IMG_0001.xmp", "/a/IMG_0002.jpg"},
+			want:  []fileGroup{{primary: "/a/IMG_0002.jpg"}},
+		},
+		{
+			name:  "files in different directories are not grouped",
+			files: []string{"/a/IMG_0001.CR3", "/b/IMG_0001.JPG"},
+			want:  []fileGroup{{primary: "/a/IMG_0001.CR3"}, {primary: "/b/IMG_0001.JPG"}},
+		},
+		{
+			name:  "other file types are left out",
+			files: []string{"/a/IMG_0001.JPG", "/a/IMG_0001.png", "/a/notes.txt"},
+			want:  []fileGroup{{primary: "/a/IMG_0001.JPG"}},
+		},
+		{
+			name:  "groups keep the order they are found in",
+			files: []string{"/a/IMG_0002.jpg", "/a/IMG_0001.jpg", "/a/IMG_0002.xmp"},
+			want:  []fileGroup{{primary: "/a/IMG_0002.jpg", companions: []string{"/a/IMG_0002.xmp"}}, {primary: "/a/IMG_0001.jpg"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupFiles(tt.files, fileTypes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupFiles() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompanionDestPath(t *testing.T) {
+	tests := []struct {
+		primaryDest, primary, file string
+		want                       string
+	}{
+		{"/dest/2023/IMG_0001.CR3", "/card/IMG_0001.CR3", "/card/IMG_0001.JPG", "/dest/2023/IMG_0001.JPG"},
+		{"/dest/2023/IMG_0001_1.CR3", "/card/IMG_0001.CR3", "/card/IMG_0001.CR3.xmp", "/dest/2023/IMG_0001_1.CR3.xmp"},
+		{"/dest/2023/20230714_093015.cr3", "/card/IMG_0001.CR3", "/card/IMG_0001.xmp", "/dest/2023/20230714_093015.xmp"},
+	}
+	for _, tt := range tests {
+		if got := companionDestPath(tt.primaryDest, tt.primary, tt.file); got != tt.want {
+			t.Errorf("companionDestPath(%s, %s, %s) = %s, want %s", tt.primaryDest, tt.primary, tt.file, got, tt.want)
+		}
+	}
+}
+
+// TestFixedGroup adds companions to a raw that was already imported, under a
+// numbered name. They join the raw where it is, and a companion whose place
+// is taken by a different file fails rather than moving the group.
+func TestFixedGroup(t *testing.T) {
+	tests := []struct {
+		name string
+		// taken is what is already at the JPEG's destination, if anything
+		taken       string
+		want        map[string]string
+		wantFailure string
+	}{
+		{
+			name: "companions join the primary",
+			want: map[string]string{"IMG_20230714_093015_1.cr2": "raw", "IMG_20230714_093015_1.jpg": "jpeg",
+				"IMG_20230714_093015_1.xmp": "edit"},
+		},
+		{
+			name:        "taken companion destination",
+			taken:       "other jpeg",
+			want:        map[string]string{"IMG_20230714_093015_1.cr2": "raw", "IMG_20230714_093015_1.jpg": "other jpeg", "IMG_20230714_093015_2.jpg": ""},
+			wantFailure: "cannot be renamed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, trees := newTestService(t, SortCriteria{})
+			dest := filepath.Join(trees.localRaw, "2023")
+			writeFile(t, filepath.Join(dest, "IMG_20230714_093015.cr2"), "other raw")
+			writeFile(t, filepath.Join(trees.raw, "IMG_20230714_093015.cr2"), "raw")
+			if err := s.ImportRawFiles(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			writeFile(t, filepath.Join(trees.raw, "IMG_20230714_093015.jpg"), "jpeg")
+			writeFile(t, filepath.Join(trees.raw, "IMG_20230714_093015.xmp"), "edit")
+			writeFile(t, filepath.Join(dest, "IMG_20230714_093015_1.jpg"), tt.taken)
+			if err := s.ImportRawFiles(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range tt.want {
+				if got := readFile(t, filepath.Join(dest, name)); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			failures := s.Failures()
+			switch {
+			case tt.wantFailure == "" && len(failures) != 0:
+				t.Errorf("Failures() = %+v, want none", failures)
+			case tt.wantFailure != "" && (len(failures) != 1 || !strings.Contains(failures[0].Cause, tt.wantFailure)):
+				t.Errorf("Failures() = %+v, want one that %s", failures, tt.wantFailure)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package sorting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/domain/files"
+	"github.com/downing/media-manager/pkg/genutils"
+	"github.com/downing/media-manager/pkg/pathtemplate"
+	runtimestats "github.com/downing/media-manager/pkg/runtime_stats"
+	"go.uber.org/zap"
+)
+
+// testTrees are the media paths of a test service, each a temporary directory.
+type testTrees struct {
+	raw, localRaw, edited, backup string
+}
+
+// newTestService returns a service over temporary media paths and catalog.
+// Files are dated by their names, such as IMG_20230714_093015.CR2, and
+// imported to {year}/{filename} unless criteria says otherwise.
+func newTestService(t *testing.T, criteria SortCriteria) (*Service, *catalog.Service, testTrees) {
+	t.Helper()
+	trees := testTrees{raw: t.TempDir(), localRaw: t.TempDir(), edited: t.TempDir(), backup: t.TempDir()}
+	criteria.RawPath, criteria.LocalRawPath, criteria.LocalEditedPath, criteria.BackupPath = trees.raw, trees.localRaw, trees.edited, trees.backup
+	if criteria.FileTypes == nil {
+		criteria.FileTypes = []string{"cr2", "cr3", "jpg", "tif", "mp4"}
+	}
+	if criteria.TimestampSources == nil {
+		criteria.TimestampSources = []string{"filename"}
+	}
+	if criteria.TimeZone == nil {
+		criteria.TimeZone = time.UTC
+	}
+	if !criteria.MoveFiles && !criteria.CopyFiles {
+		criteria.CopyFiles = true
+	}
+	if criteria.Collisions == "" {
+		criteria.Collisions = CollisionSuffix
+	}
+	if criteria.Duplicates == "" {
+		criteria.Duplicates = DuplicatesOff
+	}
+	if criteria.QuarantineDir == "" {
+		criteria.QuarantineDir = "quarantine"
+	}
+	criteria.ImportTemplate = parseTemplate(t, criteria.ImportTemplate, "{year}/{filename}")
+	criteria.RawBackupTemplate = parseTemplate(t, criteria.RawBackupTemplate, "raw/{year}/{filename}")
+	criteria.EditedBackupTemplate = parseTemplate(t, criteria.EditedBackupTemplate, "edited/{year}/{filename}")
+	criteria.UploadTemplate = parseTemplate(t, criteria.UploadTemplate, "{year}/{filename}")
+
+	store, err := catalog.Open(filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := NewService(zap.NewNop(), files.NewService(genutils.NewFileManager()), criteria, store, nil, runtimestats.NewStats())
+	return s, store, trees
+}
+
+func parseTemplate(t *testing.T, template pathtemplate.Template, raw string) pathtemplate.Template {
+	t.Helper()
+	if template.String() != "" {
+		return template
+	}
+	parsed, err := pathtemplate.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// writeFile writes content to path, or writes nothing when content is "".
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if content == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of path, "" when it does not exist.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// catalogEntry returns the last catalog entry for the source path and whether there is one.
+func catalogEntry(t *testing.T, store *catalog.Service, sourcePath string) (catalog.Entry, bool) {
+	t.Helper()
+	var entry catalog.Entry
+	var found bool
+	err := store.Entries(func(e catalog.Entry) error {
+		if e.SourcePath == sourcePath {
+			entry, found = e, true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry, found
+}
@@ -0,0 +1,181 @@
+package sorting
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"go.uber.org/zap"
+)
+
+// journalTransfer writes the files the job is about to copy or move to the
+// journal, before any of them is touched, so an interrupted run can be
+// finished or rolled back. Each entry is what the catalog will record.
+func (s *Service) journalTransfer(op operation, j *job) error {
+	entry := catalog.JournalEntry{
+		Operation: op.kind,
+		Action:    j.action,
+		RootPath:  op.manifestRoot,
+		StartedAt: time.Now(),
+	}
+	if !j.present {
+		entry.Files = append(entry.Files, catalog.JournalFile{Entry: mediaEntry(j.entry, j.media), Destination: j.destPath})
+	}
+	for _, c := range j.companions {
+		if !c.present {
+			entry.Files = append(entry.Files, catalog.JournalFile{Entry: mediaEntry(c.entry, j.media), Destination: c.destPath})
+		}
+	}
+	if len(entry.Files) == 0 {
+		return nil
+	}
+
+	if err := s.catalog.PutJournal(entry); err != nil {
+		return err
+	}
+	j.journal = &entry
+	return nil
+}
+
+// resumeJournal settles the transfers of the operation that an earlier run
+// started but did not record. A group whose files all reached their
+// destinations is recorded, and a move left half done is rolled back so the
+// group is whole at its source and is moved again by this run. Copies that
+// did not finish are left for this run to redo.
+func (s *Service) resumeJournal(op operation) error {
+	return s.catalog.Journal(func(entry catalog.JournalEntry) error {
+		if entry.Operation != op.kind {
+			return nil
+		}
+		s.logger.Info("Resuming interrupted transfer", zap.String("operation", op.name), zap.String("file", entry.Files[0].Entry.SourcePath),
+			zap.String("action", entry.Action), zap.Time("started_at", entry.StartedAt))
+
+		var err error
+		switch entry.Action {
+		case ActionMove:
+			err = s.resumeMove(op, entry)
+		case ActionCopy:
+			err = s.resumeCopy(entry)
+		}
+		if err != nil {
+			return err
+		}
+		return s.catalog.DeleteJournal(entry)
+	})
+}
+
+// resumeMove finishes a move whose files all reached their destinations, or
+// moves back the files of a group that was only partly moved.
+func (s *Service) resumeMove(op operation, entry catalog.JournalEntry) error {
+	moved := [][2]string{}
+	for _, f := range entry.Files {
+		done, err := s.finishMove(f)
+		if err != nil {
+			return err
+		}
+		if done {
+			moved = append(moved, [2]string{f.Entry.SourcePath, f.Destination})
+		}
+	}
+
+	switch len(moved) {
+	case 0:
+		s.logger.Info("Interrupted move had not started, files left in place", zap.String("file", entry.Files[0].Entry.SourcePath))
+		return nil
+	case len(entry.Files):
+		for _, f := range entry.Files {
+			if err := s.recordJournaled(entry, f); err != nil {
+				return err
+			}
+			if err := s.forgetChecksum(op.sourcePath, f.Entry.SourcePath); err != nil {
+				return err
+			}
+		}
+		s.logger.Info("Interrupted move finished", zap.String("file", entry.Files[0].Entry.SourcePath), zap.Int("file_count", len(moved)))
+		return nil
+	default:
+		s.undoMoves(moved)
+		s.logger.Warn("Interrupted move rolled back, group moved back to its source", zap.String("file", entry.Files[0].Entry.SourcePath),
+			zap.Int("file_count", len(moved)))
+		return nil
+	}
+}
+
+// finishMove reports whether the file reached its destination. A file that
+// was copied across devices but whose source was not removed yet has its
+// source removed once the copy is found to be identical.
+func (s *Service) finishMove(f catalog.JournalFile) (bool, error) {
+	destExists, err := s.files.DoesFileExist(f.Destination)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if file exists at destination [%s]: %w", f.Destination, err)
+	}
+	if !destExists {
+		return false, nil
+	}
+	sourceExists, err := s.files.DoesFileExist(f.Entry.SourcePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if file exists [%s]: %w", f.Entry.SourcePath, err)
+	}
+	if !sourceExists {
+		return true, nil
+	}
+
+	identical, _, err := s.sameContent(f.Entry.SourcePath, f.Destination)
+	if err != nil {
+		return false, err
+	}
+	if !identical {
+		return false, nil
+	}
+	if err := s.files.RemoveFile(f.Entry.SourcePath); err != nil {
+		return false, fmt.Errorf("failed to remove source file [%s] of finished move: %w", f.Entry.SourcePath, err)
+	}
+	return true, nil
+}
+
+// resumeCopy records the files of an interrupted copy whose destination holds
+// an identical copy, or a copy of a source that is gone.
+func (s *Service) resumeCopy(entry catalog.JournalEntry) error {
+	var recorded int
+	for _, f := range entry.Files {
+		exists, err := s.files.DoesFileExist(f.Destination)
+		if err != nil {
+			return fmt.Errorf("failed to check if file exists at destination [%s]: %w", f.Destination, err)
+		}
+		if !exists {
+			continue
+		}
+		// A copy is only renamed into place once verified, so one whose
+		// source has gone since is recorded as it is.
+		sourceExists, err := s.files.DoesFileExist(f.Entry.SourcePath)
+		if err != nil {
+			return fmt.Errorf("failed to check if file exists [%s]: %w", f.Entry.SourcePath, err)
+		}
+		if sourceExists {
+			identical, _, err := s.sameContent(f.Entry.SourcePath, f.Destination)
+			if err != nil {
+				return err
+			}
+			if !identical {
+				continue
+			}
+		}
+		if err := s.recordJournaled(entry, f); err != nil {
+			return err
+		}
+		recorded++
+	}
+	s.logger.Info("Interrupted copy resumed", zap.String("file", entry.Files[0].Entry.SourcePath), zap.Int("recorded_count", recorded),
+		zap.Int("remaining_count", len(entry.Files)-recorded))
+	return nil
+}
+
+// recordJournaled records a journaled file at its destination, hashing the
+// destination as the source may be gone.
+func (s *Service) recordJournaled(entry catalog.JournalEntry, f catalog.JournalFile) error {
+	checksum, err := s.files.HashFile(f.Destination)
+	if err != nil {
+		return fmt.Errorf("failed to hash file [%s]: %w", f.Destination, err)
+	}
+	return s.recordEntry(f.Entry, entry.Operation, entry.Action, entry.RootPath, f.Destination, checksum)
+}
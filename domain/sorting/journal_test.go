@@ -0,0 +1,158 @@
+package sorting
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/pkg/genutils"
+)
+
+// journalFile is a file of a journaled group with its contents at the source
+// and at the destination, "" where it is absent.
+type journalFile struct {
+	name   string
+	source string
+	dest   string
+}
+
+func TestResumeJournal(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		files  []journalFile
+		// want is the tree after the journal is resumed.
+		want     []journalFile
+		recorded []string
+	}{
+		{
+			name:   "half-moved group is moved back",
+			action: ActionMove,
+			files:  []journalFile{{"IMG_0001.CR2", "", "raw"}, {"IMG_0001.xmp", "sidecar", ""}},
+			want:   []journalFile{{"IMG_0001.CR2", "raw", ""}, {"IMG_0001.xmp", "sidecar", ""}},
+		},
+		{
+			name:     "finished move is recorded",
+			action:   ActionMove,
+			files:    []journalFile{{"IMG_0001.CR2", "", "raw"}, {"IMG_0001.xmp", "", "sidecar"}},
+			want:     []journalFile{{"IMG_0001.CR2", "", "raw"}, {"IMG_0001.xmp", "", "sidecar"}},
+			recorded: []string{"IMG_0001.CR2", "IMG_0001.xmp"},
+		},
+		{
+			name:     "move whose destination already matches removes the source",
+			action:   ActionMove,
+			files:    []journalFile{{"IMG_0001.CR2", "raw", "raw"}, {"IMG_0001.xmp", "", "sidecar"}},
+			want:     []journalFile{{"IMG_0001.CR2", "", "raw"}, {"IMG_0001.xmp", "", "sidecar"}},
+			recorded: []string{"IMG_0001.CR2", "IMG_0001.xmp"},
+		},
+		{
+			name:   "move whose destination differs is rolled back",
+			action: ActionMove,
+			files:  []journalFile{{"IMG_0001.CR2", "raw", "partial"}, {"IMG_0001.xmp", "", "sidecar"}},
+			want:   []journalFile{{"IMG_0001.CR2", "raw", "partial"}, {"IMG_0001.xmp", "sidecar", ""}},
+		},
+		{
+			name:   "move that had not started is left in place",
+			action: ActionMove,
+			files:  []journalFile{{"IMG_0001.CR2", "raw", ""}},
+			want:   []journalFile{{"IMG_0001.CR2", "raw", ""}},
+		},
+		{
+			name:     "copy whose destination already matches is recorded",
+			action:   ActionCopy,
+			files:    []journalFile{{"IMG_0001.CR2", "raw", "raw"}, {"IMG_0001.xmp", "sidecar", ""}},
+			want:     []journalFile{{"IMG_0001.CR2", "raw", "raw"}, {"IMG_0001.xmp", "sidecar", ""}},
+			recorded: []string{"IMG_0001.CR2"},
+		},
+		{
+			name:   "copy whose destination differs is left to redo",
+			action: ActionCopy,
+			files:  []journalFile{{"IMG_0001.CR2", "raw", "partial"}},
+			want:   []journalFile{{"IMG_0001.CR2", "raw", "partial"}},
+		},
+		{
+			name:     "copy whose source is gone is recorded",
+			action:   ActionCopy,
+			files:    []journalFile{{"IMG_0001.CR2", "", "raw"}, {"IMG_0001.xmp", "", ""}},
+			want:     []journalFile{{"IMG_0001.CR2", "", "raw"}, {"IMG_0001.xmp", "", ""}},
+			recorded: []string{"IMG_0001.CR2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store, trees := newTestService(t, SortCriteria{MoveFiles: tt.action == ActionMove, CopyFiles: tt.action == ActionCopy})
+			localRaw, backup := trees.localRaw, trees.backup
+			op := s.rawBackupOperation()
+
+			sourcePath := func(name string) string { return filepath.Join(localRaw, "2023", name) }
+			destPath := func(name string) string { return filepath.Join(backup, "2023", name) }
+
+			entry := catalog.JournalEntry{Operation: op.kind, Action: tt.action, RootPath: backup, StartedAt: time.Now()}
+			for _, f := range tt.files {
+				writeFile(t, sourcePath(f.name), f.source)
+				writeFile(t, destPath(f.name), f.dest)
+				entry.Files = append(entry.Files, catalog.JournalFile{Entry: catalog.Entry{SourcePath: sourcePath(f.name)}, Destination: destPath(f.name)})
+				if err := genutils.NewFileManager().RecordChecksum(localRaw, sourcePath(f.name), "aaaa"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.PutJournal(entry); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.resumeJournal(op); err != nil {
+				t.Fatalf("resumeJournal() error = %v", err)
+			}
+			// as a run does once it ends
+			if err := s.files.FlushChecksums(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, f := range tt.want {
+				if got := readFile(t, sourcePath(f.name)); got != f.source {
+					t.Errorf("%s at source = %q, want %q", f.name, got, f.source)
+				}
+				if got := readFile(t, destPath(f.name)); got != f.dest {
+					t.Errorf("%s at destination = %q, want %q", f.name, got, f.dest)
+				}
+			}
+
+			// the source manifest lists the files still in the source tree
+			var manifest string
+			for _, f := range tt.want {
+				if f.source != "" || tt.action == ActionCopy {
+					manifest += "aaaa  2023/" + f.name + "\n"
+				}
+			}
+			if got := readFile(t, filepath.Join(localRaw, genutils.ChecksumManifestFilename)); got != manifest {
+				t.Errorf("source manifest = %q, want %q", got, manifest)
+			}
+
+			recorded := map[string]bool{}
+			for _, name := range tt.recorded {
+				recorded[name] = true
+			}
+			for _, f := range tt.files {
+				e, found := catalogEntry(t, store, sourcePath(f.name))
+				if !recorded[f.name] {
+					if found {
+						t.Errorf("%s recorded as %+v, want it unrecorded", f.name, e.Destinations)
+					}
+					continue
+				}
+				if !found || len(e.Destinations) != 1 || e.Destinations[0].Path != destPath(f.name) || e.Destinations[0].Action != tt.action {
+					t.Errorf("%s recorded as %+v, want a %s to %s", f.name, e.Destinations, tt.action, destPath(f.name))
+				}
+			}
+
+			err := store.Journal(func(e catalog.JournalEntry) error {
+				t.Errorf("journal entry for %s left behind", e.Files[0].Entry.SourcePath)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
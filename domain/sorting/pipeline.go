@@ -0,0 +1,594 @@
+package sorting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/domain/images"
+	"github.com/downing/media-manager/pkg/genutils"
+	runtimestats "github.com/downing/media-manager/pkg/runtime_stats"
+	"go.uber.org/zap"
+)
+
+const (
+	ActionCopy   = "copy"
+	ActionMove   = "move"
+	ActionUpload = "upload"
+	ActionLink   = "link"
+	ActionSkip   = "skip"
+)
+
+var errNoFileOperation = errors.New("no file operation specified (neither move nor copy)")
+
+// operation describes one sorting run over the files in sourcePath.
+type operation struct {
+	name      string
+	doneField string
+	kind      string
+	action    string
+
+	sourcePath   string
+	manifestRoot string
+	// fileTypes are the extensions of the files the operation sorts.
+	fileTypes []string
+
+	checkedCounter   string
+	foundCounter     string
+	transferCounters map[string]string
+
+	destination func(media mediaData) string
+	// isDone reports whether the destination already holds the file and why.
+	isDone func(destPath string) (bool, string, error)
+	// reservations, for destinations on disk, keep files of one run from
+	// colliding with each other.
+	reservations *reservations
+	// groups moves companions such as RAW+JPEG pairs and sidecars with their primary file.
+	groups bool
+	// only, when set, limits the run to the groups whose primary file is in it.
+	only map[string]bool
+	// plan means the operation only works out what it would do, and writes nothing.
+	plan bool
+}
+
+// job carries one file, or a group of files, through the pipeline stages.
+// The primary file decides the metadata and destination of the group.
+type job struct {
+	index int
+	file  string
+
+	companions []*companion
+	// present means an identical copy of the primary file is already at destPath.
+	present bool
+	// quarantined means no usable timestamp was found and destPath is in the quarantine directory.
+	quarantined bool
+	// excluded means the operation's filter rules skip the group.
+	excluded bool
+
+	entry      catalog.Entry
+	media      resolvedMedia
+	action     string
+	destPath   string
+	skipReason string
+
+	// duplicateOf is an earlier file in the same run with the same content,
+	// duplicatePath a file already in the destination tree with the same
+	// content, which ActionLink links to.
+	duplicateOf   string
+	duplicatePath string
+
+	checksum string
+	err      error
+	// stage is the pipeline stage err happened in.
+	stage string
+	// journal is the journal entry of the transfer, until it is recorded.
+	journal *catalog.JournalEntry
+}
+
+// run transfers every image in the operation's source path that is not already
+// at its destination. It returns the number of files transferred.
+func (s *Service) run(ctx context.Context, op operation) (transferCount int, err error) {
+	defer func() { err = s.flushChecksums(err) }()
+
+	if err := s.resumeJournal(op); err != nil {
+		return 0, fmt.Errorf("failed to resume interrupted %s: %w", op.name, err)
+	}
+
+	jobs, err := s.findJobs(ctx, op)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.process(ctx, jobs,
+		func(j *job) { s.prepare(op, j) },
+		func(j *job) { s.place(op, j) },
+		func(j *job) { s.transfer(ctx, op, j) },
+		func(j *job, remaining int) error {
+			transferred, err := s.complete(op, j, remaining)
+			transferCount += transferred
+			return err
+		},
+	)
+	return transferCount, err
+}
+
+// findJobs lists the image files in the operation's source path, grouped with
+// their companions when the operation moves groups.
+func (s *Service) findJobs(ctx context.Context, op operation) ([]*job, error) {
+	files, err := s.files.GetFilesRecursivelyInPath(op.sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files recursively in path [%s]: %w", op.sourcePath, err)
+	}
+	if op.only != nil {
+		files = s.retriedFiles(op, files)
+	}
+	s.logger.Info("Found files for "+op.name, zap.Int("file_count", len(files)))
+	s.stats.AddToCounter(op.checkedCounter, len(files))
+
+	jobs := []*job{}
+	var mediaCount int
+
+	if op.groups {
+		for _, file := range files {
+			if !fileTypeIsInList(file, op.fileTypes) && !isSidecar(file) {
+				s.logSkippedFormat(file)
+			}
+		}
+		for _, group := range groupFiles(files, op.fileTypes) {
+			j := &job{index: len(jobs), file: group.primary}
+			for _, file := range group.companions {
+				j.companions = append(j.companions, &companion{file: file, sidecar: isSidecar(file)})
+			}
+			jobs = append(jobs, j)
+			mediaCount += 1 + len(group.companions)
+		}
+	} else {
+		for _, file := range files {
+			if !fileTypeIsInList(file, op.fileTypes) {
+				s.logSkippedFormat(file)
+				continue
+			}
+			jobs = append(jobs, &job{index: len(jobs), file: file})
+		}
+		mediaCount = len(jobs)
+	}
+	s.logger.Info("Filtered media files for "+op.name, zap.Int("media_file_count", mediaCount), zap.Int("group_count", len(jobs)))
+	s.stats.AddToCounter(op.foundCounter, mediaCount)
+
+	if err := s.markDuplicateJobs(ctx, op, jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// logSkippedFormat explains why a file in the source path is not sorted.
+func (s *Service) logSkippedFormat(file string) {
+	if format, ok := images.LookupUnsupportedFormat(file); ok {
+		s.logger.Info("Skipping unsupported photo format", zap.String("file", file), zap.String("format", format.Name),
+			zap.String("reason", format.Reason))
+		return
+	}
+	s.logger.Debug("Skipping unsupported file", zap.String("file", file))
+}
+
+// retriedFiles keeps the files being retried and, when the operation moves
+// groups, the other files of their groups.
+func (s *Service) retriedFiles(op operation, files []string) []string {
+	keys := map[string]bool{}
+	for file := range op.only {
+		keys[groupKey(file, op.fileTypes)] = true
+	}
+	kept := []string{}
+	for _, file := range files {
+		if op.only[file] || op.groups && keys[groupKey(file, op.fileTypes)] {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// process pushes the jobs through ReadJobs prepare workers, place, and
+// WriteJobs transfer workers, noting the stage a job failed in. Jobs are
+// placed and completed in order, so destinations, logs, catalog updates and
+// checksum manifests are the same as a sequential run. The first error from complete stops the remaining jobs and
+// is returned. Once ctx is cancelled no new jobs are started, jobs in flight
+// are completed with ctx's error and ctx's error is returned.
+func (s *Service) process(ctx context.Context, jobs []*job, prepare, place, transfer func(j *job), complete func(j *job, remaining int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	prepared := s.stage(ctx, max(s.criteria.ReadJobs, 1), s.walk(ctx, jobs), func(j *job) {
+		prepare(j)
+		if j.err != nil {
+			j.stage = StagePrepare
+		}
+	})
+	placed := s.inOrder(ctx, prepared, func(j *job) {
+		if j.skipReason == "" {
+			place(j)
+			if j.err != nil {
+				j.stage = StagePrepare
+			}
+		}
+	})
+	transferred := s.stage(ctx, max(s.criteria.WriteJobs, 1), placed, func(j *job) {
+		if j.skipReason == "" {
+			transfer(j)
+			if j.err != nil {
+				j.stage = StageTransfer
+			}
+		}
+	})
+
+	var firstErr error
+	pending := map[int]*job{}
+	next := 0
+	for j := range transferred {
+		pending[j.index] = j
+		for {
+			j, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if firstErr != nil {
+				continue
+			}
+
+			if err := complete(j, len(jobs)-next); err != nil {
+				firstErr = err
+				cancel()
+			}
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// walk feeds the jobs into the pipeline in order until ctx is cancelled.
+func (s *Service) walk(ctx context.Context, jobs []*job) <-chan *job {
+	out := make(chan *job)
+	go func() {
+		defer close(out)
+		for _, j := range jobs {
+			select {
+			case out <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// stage runs fn on every job from in with the given number of workers. Jobs
+// that already failed, or arrive after ctx is cancelled, are passed through.
+func (s *Service) stage(ctx context.Context, workers int, in <-chan *job, fn func(j *job)) <-chan *job {
+	out := make(chan *job)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range in {
+				if j.err == nil && ctx.Err() == nil {
+					fn(j)
+				} else if j.err == nil {
+					j.err = ctx.Err()
+				}
+				out <- j
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// inOrder runs fn on every job from in, one job at a time in job order, for
+// the steps whose outcome depends on the jobs before them. Jobs that already
+// failed, or arrive after ctx is cancelled, are passed through.
+func (s *Service) inOrder(ctx context.Context, in <-chan *job, fn func(j *job)) <-chan *job {
+	out := make(chan *job)
+	go func() {
+		defer close(out)
+		pending := map[int]*job{}
+		next := 0
+		for j := range in {
+			pending[j.index] = j
+			for {
+				j, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				if j.err == nil && ctx.Err() == nil {
+					fn(j)
+				} else if j.err == nil {
+					j.err = ctx.Err()
+				}
+				out <- j
+			}
+		}
+	}()
+	return out
+}
+
+// prepare looks the file up in the catalog, reads its metadata and works out
+// its destination, marking the job as skipped when there is nothing to do.
+func (s *Service) prepare(op operation, j *job) {
+	if op.action == "" {
+		j.err = errNoFileOperation
+		return
+	}
+	j.action = op.action
+
+	// skip groups the catalog has already sent to this destination
+	entry, err := s.lookupEntry(j.file)
+	if err != nil {
+		j.err = err
+		return
+	}
+	j.entry = entry
+	catalogued := entry.HasDestination(op.kind)
+	for _, c := range j.companions {
+		c.entry, err = s.lookupEntry(c.file)
+		if err != nil {
+			j.err = err
+			return
+		}
+		catalogued = catalogued && c.entry.HasDestination(op.kind)
+	}
+	if catalogued {
+		j.skipReason = "file already in catalog"
+		return
+	}
+
+	// get photo or video data, before the filter rules when they need it
+	var loaded *resolvedMedia
+	loadMedia := func() resolvedMedia {
+		if loaded == nil {
+			media := s.getMediaData(j.file)
+			loaded = &media
+		}
+		return *loaded
+	}
+	s.checkFilter(op, j, loadMedia)
+	if j.skipReason != "" {
+		return
+	}
+	media := loadMedia()
+	j.media = media
+	switch {
+	case media.source != "":
+		j.destPath = op.destination(media)
+	case op.manifestRoot == "":
+		j.skipReason = "no usable timestamp"
+		return
+	default:
+		j.destPath = s.quarantinePath(op, j.file)
+		j.quarantined = true
+	}
+
+	// new companions of a file that was already sent join it there
+	if destPath := entry.DestinationPath(op.kind); destPath != "" {
+		j.destPath = destPath
+		j.present = true
+	}
+	for _, c := range j.companions {
+		c.destPath = companionDestPath(j.destPath, j.file, c.file)
+	}
+
+	if !s.criteria.Since.IsZero() && !j.quarantined && media.GetTimestamp().Before(s.criteria.Since) {
+		j.skipReason = "taken before since"
+		return
+	}
+
+	if op.isDone != nil {
+		done, reason, err := op.isDone(j.destPath)
+		if err != nil {
+			j.err = err
+			return
+		}
+		if done {
+			j.skipReason = reason
+			return
+		}
+	}
+
+}
+
+// place skips or links a duplicate and claims the job's destinations. It runs
+// in job order, so when two files of a run want one destination the earlier
+// file keeps it.
+func (s *Service) place(op operation, j *job) {
+	s.checkDuplicate(op, j)
+	if j.skipReason != "" || op.reservations == nil {
+		return
+	}
+	s.resolveCollision(op, j)
+}
+
+// transfer copies, moves, links or uploads the job's files to their
+// destinations. Copies and moves are journaled first. When moving a group
+// fails part way, the files already moved are moved back so the group is
+// never split.
+func (s *Service) transfer(ctx context.Context, op operation, j *job) {
+	switch j.action {
+	case ActionLink:
+		j.err = s.files.LinkFile(j.duplicatePath, j.destPath)
+		if j.err != nil {
+			j.err = fmt.Errorf("failed to link file [%s] to [%s]: %w", j.duplicatePath, j.destPath, j.err)
+		}
+		return
+	case ActionUpload:
+		j.err = s.uploader.Upload(ctx, j.file, j.destPath)
+		if j.err != nil {
+			j.err = fmt.Errorf("failed to upload file [%s] as [%s]: %w", j.file, j.destPath, j.err)
+		}
+		return
+	}
+
+	if j.err = s.journalTransfer(op, j); j.err != nil {
+		return
+	}
+	moved := [][2]string{}
+	if !j.present {
+		j.checksum, j.err = s.transferFile(ctx, j.action, j.file, j.destPath)
+		if j.err != nil {
+			return
+		}
+		moved = append(moved, [2]string{j.file, j.destPath})
+	}
+	for _, c := range j.companions {
+		if c.present {
+			continue
+		}
+		c.checksum, j.err = s.transferFile(ctx, j.action, c.file, c.destPath)
+		if j.err != nil {
+			if j.action == ActionMove {
+				s.undoMoves(moved)
+			}
+			return
+		}
+		moved = append(moved, [2]string{c.file, c.destPath})
+	}
+}
+
+// transferFile copies or moves one file and returns its checksum.
+func (s *Service) transferFile(ctx context.Context, action, file, destPath string) (string, error) {
+	switch action {
+	case ActionCopy:
+		checksum, err := s.files.CopyFile(ctx, file, destPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to copy file [%s] to [%s]: %w", file, destPath, err)
+		}
+		return checksum, nil
+	case ActionMove:
+		checksum, err := s.files.MoveFile(ctx, file, destPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to move file [%s] to [%s]: %w", file, destPath, err)
+		}
+		return checksum, nil
+	default:
+		return "", fmt.Errorf("unknown action [%s] for file [%s]", action, file)
+	}
+}
+
+// undoMoves moves files back to where they came from, newest first. It is
+// not cancelled with the run, so a group is never left split.
+func (s *Service) undoMoves(moved [][2]string) {
+	for i := len(moved) - 1; i >= 0; i-- {
+		source, destPath := moved[i][0], moved[i][1]
+		if _, err := s.files.MoveFile(context.Background(), destPath, source); err != nil {
+			s.logger.Error("Failed to move file back after its group failed to move", zap.String("file", source), zap.String("dest_path", destPath), zap.Error(err))
+		}
+	}
+}
+
+// complete logs the outcome of a job and records successful transfers, or
+// the failure of a job so the run carries on, then removes the job from the
+// journal. It returns the number of files transferred, an error means the
+// catalog or manifest could not be updated and stops the run.
+func (s *Service) complete(op operation, j *job, remaining int) (int, error) {
+	transferred, err := s.completeJob(op, j, remaining)
+	if err != nil || j.journal == nil {
+		return transferred, err
+	}
+	return transferred, s.catalog.DeleteJournal(*j.journal)
+}
+
+func (s *Service) completeJob(op operation, j *job, remaining int) (int, error) {
+	logMsg := fmt.Sprintf("%d files remaining", remaining)
+
+	switch {
+	case errors.Is(j.err, genutils.ErrChecksumMismatch):
+		s.checksumFailed(j.file, j.destPath, j.err)
+		s.fail(op, j, StageVerify)
+		return 0, nil
+	case errors.Is(j.err, errNoFileOperation):
+		s.logger.Warn("No file operation specified (neither move nor copy)", zap.String("file", j.file))
+		return 0, nil
+	case errors.Is(j.err, context.Canceled):
+		// interrupted, not failed, the next run picks the file up again
+		s.logger.Debug("Interrupted before the file was transferred", zap.String("file", j.file))
+		return 0, nil
+	case j.err != nil:
+		s.fail(op, j, j.stage)
+		return 0, nil
+	case j.skipReason != "":
+		s.logger.Debug(logMsg, zap.String("file", j.file), zap.Bool(op.doneField, false), zap.String("reason", j.skipReason))
+		if j.duplicatePath != "" || j.duplicateOf != "" {
+			s.stats.IncrementCounter(runtimestats.DuplicatesSkipped)
+		}
+		if j.excluded {
+			s.stats.IncrementCounter(runtimestats.FilesExcluded)
+		}
+		if j.duplicatePath == "" {
+			return 0, nil
+		}
+		// the content is already at the destination, remember where
+		return 0, s.recordDestination(j.entry, j.media, op.kind, j.action, "", j.duplicatePath, j.checksum)
+	}
+
+	var transferred int
+	done, err := s.completeFile(op, j, j.file, j.entry, j.destPath, j.checksum, j.present)
+	if err != nil {
+		return transferred, err
+	}
+	if done {
+		transferred++
+	}
+	for _, c := range j.companions {
+		done, err := s.completeFile(op, j, c.file, c.entry, c.destPath, c.checksum, c.present)
+		if err != nil {
+			return transferred, err
+		}
+		if done {
+			transferred++
+		}
+	}
+
+	s.logger.Debug(logMsg, zap.String("file", j.file), zap.Bool(op.doneField, transferred > 0), zap.Int("file_count", transferred))
+	return transferred, nil
+}
+
+// completeFile records one file of a job at its destination. Files that were
+// already there are only added to the catalog. It reports whether the file was
+// transferred.
+func (s *Service) completeFile(op operation, j *job, file string, entry catalog.Entry, destPath, checksum string, present bool) (bool, error) {
+	if present {
+		if entry.HasDestinationPath(op.kind, destPath) {
+			return false, nil
+		}
+		return false, s.recordDestination(entry, j.media, op.kind, "", "", destPath, checksum)
+	}
+
+	err := s.recordDestination(entry, j.media, op.kind, j.action, op.manifestRoot, destPath, checksum)
+	if err != nil {
+		return false, err
+	}
+	if err := s.indexTransfer(op, j.action, file, destPath, entry, checksum); err != nil {
+		return false, err
+	}
+	if j.action == ActionMove {
+		if err := s.forgetChecksum(op.sourcePath, file); err != nil {
+			return false, err
+		}
+	}
+	s.stats.IncrementCounter(op.transferCounters[j.action])
+	if j.quarantined {
+		s.stats.IncrementCounter(runtimestats.FilesQuarantined)
+	}
+	return true, nil
+}
@@ -0,0 +1,326 @@
+package sorting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"go.uber.org/zap"
+)
+
+const (
+	PlanFormatTable = "table"
+	PlanFormatJSON  = "json"
+)
+
+// Plan is the list of actions a run would take, it can be saved as JSON and executed later.
+type Plan struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Actions   []PlannedAction `json:"actions"`
+}
+
+// PlannedAction is what will happen to one source file. Size and ModTime are
+// the source as planned, execution refuses to touch a file that has changed.
+// Checksum, when known, is what the copy is expected to hash to. LinkTarget is
+// the existing copy a link action links to. Group is the primary file of the
+// group a companion file travels with.
+type PlannedAction struct {
+	Operation   string    `json:"operation"`
+	Action      string    `json:"action"`
+	Reason      string    `json:"reason,omitempty"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination,omitempty"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Checksum    string    `json:"checksum,omitempty"`
+	LinkTarget  string    `json:"link_target,omitempty"`
+	Group       string    `json:"group,omitempty"`
+}
+
+// PlanImportRawFiles returns what ImportRawFiles would do without writing anything.
+func (s *Service) PlanImportRawFiles(ctx context.Context) ([]PlannedAction, error) {
+	return s.plan(ctx, s.importOperation())
+}
+
+// PlanBackupLocalRawFiles returns what BackupLocalRawFiles would do without writing anything.
+func (s *Service) PlanBackupLocalRawFiles(ctx context.Context) ([]PlannedAction, error) {
+	return s.plan(ctx, s.rawBackupOperation())
+}
+
+// PlanBackupEditedFiles returns what BackupEditedFiles would do without writing anything.
+func (s *Service) PlanBackupEditedFiles(ctx context.Context) ([]PlannedAction, error) {
+	return s.plan(ctx, s.editedBackupOperation())
+}
+
+// PlanUploadEditedFiles returns what UploadEditedFiles would do without writing anything.
+func (s *Service) PlanUploadEditedFiles(ctx context.Context) ([]PlannedAction, error) {
+	if s.uploader == nil {
+		return nil, fmt.Errorf("no uploader configured")
+	}
+	return s.plan(ctx, s.uploadOperation())
+}
+
+func (s *Service) plan(ctx context.Context, op operation) ([]PlannedAction, error) {
+	op.plan = true
+	jobs, err := s.findJobs(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []PlannedAction{}
+	err = s.process(ctx, jobs,
+		func(j *job) { s.prepare(op, j) },
+		func(j *job) { s.place(op, j) },
+		func(*job) {},
+		func(j *job, _ int) error {
+			action := PlannedAction{
+				Operation:   op.kind,
+				Action:      j.action,
+				Reason:      j.skipReason,
+				Source:      j.file,
+				Destination: j.destPath,
+				Size:        j.entry.Size,
+				ModTime:     j.entry.ModTime,
+			}
+			switch {
+			case errors.Is(j.err, errNoFileOperation):
+				action.Action = ActionSkip
+				action.Reason = errNoFileOperation.Error()
+			case j.err != nil:
+				action.Action = ActionSkip
+				action.Reason = "failed to " + j.stage + ": " + j.err.Error()
+			case j.skipReason != "":
+				action.Action = ActionSkip
+			case j.present:
+				action.Action = ActionSkip
+				action.Reason = presentReason(j.entry, op.kind)
+			case j.action == ActionLink:
+				action.LinkTarget = j.duplicatePath
+				action.Checksum = j.checksum
+			}
+			actions = append(actions, action)
+
+			for _, c := range j.companions {
+				companionAction := PlannedAction{
+					Operation:   op.kind,
+					Action:      action.Action,
+					Reason:      action.Reason,
+					Source:      c.file,
+					Destination: c.destPath,
+					Size:        c.entry.Size,
+					ModTime:     c.entry.ModTime,
+					Group:       j.file,
+				}
+				if action.Reason == "" || j.present {
+					companionAction.Action = j.action
+					companionAction.Reason = ""
+					if c.present {
+						companionAction.Action = ActionSkip
+						companionAction.Reason = presentReason(c.entry, op.kind)
+					}
+				}
+				actions = append(actions, companionAction)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// presentReason explains why a file that is already at its destination is not transferred.
+func presentReason(entry catalog.Entry, kind string) string {
+	if entry.HasDestination(kind) {
+		return "file already in catalog"
+	}
+	return "identical file already at destination"
+}
+
+// ExecutePlan performs exactly the copy, move and upload actions in the plan.
+// Skipped actions are ignored and destinations are not recomputed. Files of a
+// group are executed together with their primary file.
+func (s *Service) ExecutePlan(ctx context.Context, plan Plan) (err error) {
+	defer func() { err = s.flushChecksums(err) }()
+
+	for _, group := range groupActionsByOperation(plan.Actions) {
+		op, err := s.operationForKind(group[0].Operation)
+		if err != nil {
+			return err
+		}
+
+		if err := s.resumeJournal(op); err != nil {
+			return fmt.Errorf("failed to resume interrupted %s: %w", op.name, err)
+		}
+
+		jobs := planJobs(group)
+		planned := map[string]PlannedAction{}
+		for _, action := range group {
+			planned[action.Source] = action
+		}
+		s.logger.Info("Executing planned "+op.name, zap.Int("action_count", len(jobs)))
+
+		var executed int
+		err = s.process(ctx, jobs,
+			func(j *job) { s.preparePlanned(op, planned, j) },
+			func(*job) {},
+			func(j *job) { s.transfer(ctx, op, j) },
+			func(j *job, remaining int) error {
+				transferred, err := s.complete(op, j, remaining)
+				executed += transferred
+				return err
+			},
+		)
+		if err != nil {
+			return err
+		}
+		s.logger.Info("Planned "+op.name+" completed", zap.Int("file_count", executed))
+	}
+	return nil
+}
+
+// planJobs turns the actions of one operation into jobs, one per group that
+// has something to do. A primary file whose action is skipped stays in place
+// while its companions are transferred.
+func planJobs(actions []PlannedAction) []*job {
+	all := []*job{}
+	byPrimary := map[string]*job{}
+	for _, action := range actions {
+		primary := action.Source
+		if action.Group != "" {
+			primary = action.Group
+		}
+		j, ok := byPrimary[primary]
+		if !ok {
+			j = &job{file: primary, present: true}
+			byPrimary[primary] = j
+			all = append(all, j)
+		}
+
+		if action.Action == ActionSkip {
+			continue
+		}
+		if action.Group == "" {
+			j.present = false
+			continue
+		}
+		j.companions = append(j.companions, &companion{file: action.Source, sidecar: isSidecar(action.Source)})
+	}
+
+	jobs := []*job{}
+	for _, j := range all {
+		if j.present && len(j.companions) == 0 {
+			continue
+		}
+		j.index = len(jobs)
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// preparePlanned fills the job from its planned actions, checking the files
+// have not changed since planning.
+func (s *Service) preparePlanned(op operation, planned map[string]PlannedAction, j *job) {
+	action := planned[j.file]
+	j.action = action.Action
+	j.destPath = action.Destination
+	j.duplicatePath = action.LinkTarget
+	j.checksum = action.Checksum
+	for _, c := range j.companions {
+		j.action = planned[c.file].Action
+	}
+
+	entry, err := s.lookupEntry(j.file)
+	if err != nil {
+		j.err = err
+		return
+	}
+	j.entry = entry
+	if !j.present && entry.HasDestinationPath(op.kind, action.Destination) {
+		j.skipReason = "planned action already executed"
+		return
+	}
+	if !j.present && !entry.Matches(action.Size, action.ModTime) {
+		j.err = fmt.Errorf("file [%s] changed since the plan was made", j.file)
+		return
+	}
+
+	j.media = s.getMediaData(j.file)
+
+	if op.reservations == nil {
+		return
+	}
+	if !j.present {
+		j.present, j.checksum, j.err = s.checkPlannedFile(j.file, j.destPath, false)
+		if j.err != nil {
+			return
+		}
+	}
+	for _, c := range j.companions {
+		companionAction := planned[c.file]
+		c.destPath = companionAction.Destination
+		c.entry, err = s.lookupEntry(c.file)
+		if err != nil {
+			j.err = err
+			return
+		}
+		if !c.entry.Matches(companionAction.Size, companionAction.ModTime) {
+			j.err = fmt.Errorf("file [%s] changed since the plan was made", c.file)
+			return
+		}
+		c.present, c.checksum, j.err = s.checkPlannedFile(c.file, c.destPath, c.sidecar)
+		if j.err != nil {
+			return
+		}
+	}
+}
+
+// groupActionsByOperation splits the actions by operation, keeping the order operations first appear in.
+func groupActionsByOperation(actions []PlannedAction) [][]PlannedAction {
+	groups := [][]PlannedAction{}
+	index := map[string]int{}
+	for _, action := range actions {
+		i, ok := index[action.Operation]
+		if !ok {
+			i = len(groups)
+			index[action.Operation] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], action)
+	}
+	return groups
+}
+
+// WritePlan writes the plan as a table for people or as JSON that ReadPlan can load.
+func WritePlan(w io.Writer, plan Plan, format string) error {
+	switch format {
+	case PlanFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	case PlanFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "OPERATION\tACTION\tSOURCE\tDESTINATION\tREASON")
+		for _, action := range plan.Actions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", action.Operation, action.Action, action.Source, action.Destination, action.Reason)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown plan format: %s, choose from [%s, %s]", format, PlanFormatTable, PlanFormatJSON)
+	}
+}
+
+// ReadPlan loads a plan written by WritePlan in JSON format.
+func ReadPlan(r io.Reader) (Plan, error) {
+	var plan Plan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return Plan{}, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	return plan, nil
+}
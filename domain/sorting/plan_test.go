@@ -0,0 +1,196 @@
+package sorting
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+)
+
+// planImport plans the import, writes the plan as JSON and reads it back, as
+// a plan saved by one run and executed by another is.
+func planImport(t *testing.T, s *Service) Plan {
+	t.Helper()
+	actions, err := s.PlanImportRawFiles(context.Background())
+	if err != nil {
+		t.Fatalf("PlanImportRawFiles() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WritePlan(&buf, Plan{CreatedAt: time.Now(), Actions: actions}, PlanFormatJSON); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+	plan, err := ReadPlan(&buf)
+	if err != nil {
+		t.Fatalf("ReadPlan() error = %v", err)
+	}
+	return plan
+}
+
+func TestPlanRoundTrip(t *testing.T) {
+	s, store, trees := newTestService(t, SortCriteria{})
+	source := filepath.Join(trees.raw, "IMG_20230714_093015.jpg")
+	writeFile(t, source, "photo")
+	dest := filepath.Join(trees.localRaw, "2023", "IMG_20230714_093015.jpg")
+
+	actions, err := s.PlanImportRawFiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := Plan{CreatedAt: time.Date(2023, 7, 15, 8, 0, 0, 0, time.UTC), Actions: actions}
+	var buf bytes.Buffer
+	if err := WritePlan(&buf, plan, PlanFormatJSON); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+	read, err := ReadPlan(&buf)
+	if err != nil {
+		t.Fatalf("ReadPlan() error = %v", err)
+	}
+
+	if !read.CreatedAt.Equal(plan.CreatedAt) || len(read.Actions) != 1 {
+		t.Fatalf("ReadPlan() = %+v, want %+v", read, plan)
+	}
+	got, want := read.Actions[0], plan.Actions[0]
+	if !got.ModTime.Equal(want.ModTime) {
+		t.Errorf("ModTime = %v, want %v", got.ModTime, want.ModTime)
+	}
+	got.ModTime, want.ModTime = time.Time{}, time.Time{}
+	if got != want {
+		t.Errorf("action = %+v, want %+v", got, want)
+	}
+	if want.Action != ActionCopy || want.Source != source || want.Destination != dest || want.Size != int64(len("photo")) {
+		t.Errorf("planned %+v, want a copy of %s to %s", want, source, dest)
+	}
+	if got := readFile(t, dest); got != "" {
+		t.Fatalf("planning wrote %s", dest)
+	}
+
+	if err := s.ExecutePlan(context.Background(), read); err != nil {
+		t.Fatalf("ExecutePlan() error = %v", err)
+	}
+	if got := readFile(t, dest); got != "photo" {
+		t.Errorf("destination = %q, want %q", got, "photo")
+	}
+	if entry, found := catalogEntry(t, store, source); !found || !entry.HasDestinationPath(catalog.KindImport, dest) {
+		t.Errorf("catalog entry = %+v, want the import to %s", entry, dest)
+	}
+}
+
+func TestPlanReadRejectsInvalid(t *testing.T) {
+	if _, err := ReadPlan(strings.NewReader("OPERATION  ACTION")); err == nil {
+		t.Error("ReadPlan() of a table succeeded")
+	}
+	if err := WritePlan(&bytes.Buffer{}, Plan{}, "yaml"); err == nil {
+		t.Error("WritePlan() in an unknown format succeeded")
+	}
+}
+
+func TestExecutePlanRefusesChangedSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, source string)
+	}{
+		{"content", func(t *testing.T, source string) {
+			writeFile(t, source, "edited photo")
+		}},
+		{"modification time", func(t *testing.T, source string) {
+			if err := os.Chtimes(source, time.Now(), time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store, trees := newTestService(t, SortCriteria{})
+			source := filepath.Join(trees.raw, "IMG_20230714_093015.jpg")
+			writeFile(t, source, "photo")
+			plan := planImport(t, s)
+
+			tt.change(t, source)
+			if err := s.ExecutePlan(context.Background(), plan); err != nil {
+				t.Fatalf("ExecutePlan() error = %v", err)
+			}
+
+			if got := readFile(t, filepath.Join(trees.localRaw, "2023", "IMG_20230714_093015.jpg")); got != "" {
+				t.Errorf("changed source copied as %q", got)
+			}
+			failures := s.Failures()
+			if len(failures) != 1 || failures[0].File != source || !strings.Contains(failures[0].Cause, "changed since the plan was made") {
+				t.Errorf("Failures() = %+v, want %s changed since the plan", failures, source)
+			}
+			if entry, found := catalogEntry(t, store, source); found && entry.HasDestination(catalog.KindImport) {
+				t.Errorf("changed source recorded as %+v", entry.Destinations)
+			}
+		})
+	}
+}
+
+func TestExecutePlanSkippedPrimaryTransfersCompanions(t *testing.T) {
+	s, _, trees := newTestService(t, SortCriteria{})
+	for _, name := range []string{"IMG_20230714_093015.cr2", "IMG_20230714_093015.jpg", "IMG_20230714_093015.xmp"} {
+		writeFile(t, filepath.Join(trees.raw, name), "content of "+name)
+	}
+	// the raw is already imported, its JPEG and sidecar are not
+	writeFile(t, filepath.Join(trees.localRaw, "2023", "IMG_20230714_093015.cr2"), "content of IMG_20230714_093015.cr2")
+
+	plan := planImport(t, s)
+	primary := filepath.Join(trees.raw, "IMG_20230714_093015.cr2")
+	want := map[string]PlannedAction{
+		"IMG_20230714_093015.cr2": {Action: ActionSkip, Reason: "identical file already at destination"},
+		"IMG_20230714_093015.jpg": {Action: ActionCopy, Group: primary},
+		"IMG_20230714_093015.xmp": {Action: ActionCopy, Group: primary},
+	}
+	if len(plan.Actions) != len(want) {
+		t.Fatalf("planned %+v, want %d actions", plan.Actions, len(want))
+	}
+	for _, action := range plan.Actions {
+		name := filepath.Base(action.Source)
+		if w := want[name]; action.Action != w.Action || action.Reason != w.Reason || action.Group != w.Group ||
+			action.Destination != filepath.Join(trees.localRaw, "2023", name) {
+			t.Errorf("planned %s as %+v, want %+v", name, action, w)
+		}
+	}
+
+	if err := s.ExecutePlan(context.Background(), plan); err != nil {
+		t.Fatalf("ExecutePlan() error = %v", err)
+	}
+	if failures := s.Failures(); len(failures) != 0 {
+		t.Fatalf("Failures() = %+v, want none", failures)
+	}
+	for name := range want {
+		if got := readFile(t, filepath.Join(trees.localRaw, "2023", name)); got != "content of "+name {
+			t.Errorf("%s at destination = %q, want its content", name, got)
+		}
+	}
+}
+
+func TestExecutePlanTwice(t *testing.T) {
+	s, store, trees := newTestService(t, SortCriteria{})
+	source := filepath.Join(trees.raw, "IMG_20230714_093015.jpg")
+	writeFile(t, source, "photo")
+	plan := planImport(t, s)
+
+	for range 2 {
+		if err := s.ExecutePlan(context.Background(), plan); err != nil {
+			t.Fatalf("ExecutePlan() error = %v", err)
+		}
+	}
+
+	if failures := s.Failures(); len(failures) != 0 {
+		t.Errorf("Failures() = %+v, want none", failures)
+	}
+	files, err := os.ReadDir(filepath.Join(trees.localRaw, "2023"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("destination holds %d files, want the one copy", len(files))
+	}
+	if entry, _ := catalogEntry(t, store, source); len(entry.Destinations) != 1 {
+		t.Errorf("catalog destinations = %+v, want one import", entry.Destinations)
+	}
+}
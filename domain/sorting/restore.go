@@ -0,0 +1,131 @@
+package sorting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/pkg/genutils"
+	"go.uber.org/zap"
+)
+
+const OperationRestore = "restore"
+
+// PlanRestore lists the local raw and edited files, taken since the given
+// time, that are missing and can be copied back from their backups. With a
+// target directory the files are restored under it, keeping their path
+// relative to the local raw or edited path, instead of to their original path.
+func (s *Service) PlanRestore(targetDir string, since time.Time) ([]PlannedAction, error) {
+	actions := []PlannedAction{}
+	// planned is the action for each restore path and when its backup was
+	// made, as a path catalogued for more than one file is restored from the
+	// latest backup
+	type planned struct {
+		index      int
+		recordedAt time.Time
+	}
+	restores := map[string]planned{}
+	err := s.catalog.Entries(func(entry catalog.Entry) error {
+		if entry.Timestamp.Before(since) {
+			return nil
+		}
+		for _, dest := range entry.Destinations {
+			if dest.Kind != catalog.KindRawBackup && dest.Kind != catalog.KindEditedBackup {
+				continue
+			}
+
+			restorePath, err := s.restorePath(entry.SourcePath, dest.Kind, targetDir)
+			if err != nil {
+				return err
+			}
+			exists, err := s.files.DoesFileExist(restorePath)
+			if err != nil {
+				return fmt.Errorf("failed to check if file exists [%s]: %w", restorePath, err)
+			}
+
+			action := PlannedAction{
+				Operation:   OperationRestore,
+				Action:      ActionCopy,
+				Source:      dest.Path,
+				Destination: restorePath,
+				Size:        entry.Size,
+				Checksum:    dest.Checksum,
+			}
+			if exists {
+				action.Action = ActionSkip
+				action.Reason = "file already exists at destination"
+			}
+			if earlier, ok := restores[restorePath]; ok {
+				if dest.RecordedAt.After(earlier.recordedAt) {
+					actions[earlier.index] = action
+					restores[restorePath] = planned{index: earlier.index, recordedAt: dest.RecordedAt}
+				}
+				break
+			}
+			restores[restorePath] = planned{index: len(actions), recordedAt: dest.RecordedAt}
+			actions = append(actions, action)
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan restore: %w", err)
+	}
+	return actions, nil
+}
+
+// Restore copies the planned files back from backup, checking each copy
+// against the checksum recorded when it was backed up. It returns the number
+// of files restored and the ones that failed verification.
+func (s *Service) Restore(ctx context.Context, actions []PlannedAction) (int, []string, error) {
+	var restored int
+	failed := []string{}
+	for _, action := range actions {
+		if action.Action == ActionSkip {
+			continue
+		}
+
+		checksum, err := s.files.CopyFile(ctx, action.Source, action.Destination)
+		if errors.Is(err, genutils.ErrChecksumMismatch) {
+			s.checksumFailed(action.Source, action.Destination, err)
+			failed = append(failed, action.Destination)
+			continue
+		}
+		if err != nil {
+			return restored, failed, fmt.Errorf("failed to restore file [%s] to [%s]: %w", action.Source, action.Destination, err)
+		}
+
+		if action.Checksum != "" && checksum != action.Checksum {
+			s.logger.Error("Restored file does not match the checksum recorded at backup", zap.String("file", action.Destination))
+			failed = append(failed, action.Destination)
+			continue
+		}
+
+		s.logger.Debug("Restored file", zap.String("file", action.Source), zap.String("dest_path", action.Destination))
+		restored++
+	}
+
+	s.logger.Info("Restore completed", zap.Int("file_count", restored), zap.Int("failed_count", len(failed)))
+	return restored, failed, nil
+}
+
+// restorePath returns where a local file backed up as the given kind is restored to.
+func (s *Service) restorePath(sourcePath, kind, targetDir string) (string, error) {
+	if targetDir == "" {
+		return sourcePath, nil
+	}
+
+	basePath := s.criteria.LocalRawPath
+	if kind == catalog.KindEditedBackup {
+		basePath = s.criteria.LocalEditedPath
+	}
+	relPath, err := filepath.Rel(basePath, sourcePath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		relPath = filepath.Base(sourcePath)
+	}
+	return filepath.Join(targetDir, relPath), nil
+}
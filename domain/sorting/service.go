@@ -1,16 +1,27 @@
 package sorting
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/domain/filters"
 	"github.com/downing/media-manager/domain/images"
+	"github.com/downing/media-manager/domain/timestamps"
+	"github.com/downing/media-manager/domain/upload"
+	"github.com/downing/media-manager/pkg/pathtemplate"
 	runtimestats "github.com/downing/media-manager/pkg/runtime_stats"
 	"go.uber.org/zap"
 )
 
 type SortCriteria struct {
+	// FileTypes are the extensions, without the dot, of the files to sort.
 	FileTypes []string
 
 	RawPath         string
@@ -20,13 +31,61 @@ type SortCriteria struct {
 
 	MoveFiles bool
 	CopyFiles bool
+
+	// Collisions is what to do when a different file is already at a
+	// destination, one of CollisionSkipIfIdentical, CollisionSuffix,
+	// CollisionError or CollisionOverwrite.
+	Collisions string
+
+	// Duplicates is what to do with a file whose content is already in the
+	// destination tree, one of DuplicatesSkip, DuplicatesHardlink or DuplicatesOff.
+	Duplicates string
+
+	// Destination layouts, relative to the local raw path, the backup path and the upload destination.
+	ImportTemplate       pathtemplate.Template
+	RawBackupTemplate    pathtemplate.Template
+	EditedBackupTemplate pathtemplate.Template
+	UploadTemplate       pathtemplate.Template
+
+	// Since skips files taken before it, when set.
+	Since time.Time
+
+	// TimestampSources is the order the timestamps sources are tried in to
+	// find when a file was taken.
+	TimestampSources []string
+	// QuarantineDir is where files with no usable timestamp go, relative to
+	// the destination tree unless absolute.
+	QuarantineDir string
+	// ClockOffsets correct the clocks of cameras that were set wrong.
+	ClockOffsets timestamps.OffsetRules
+	// TimeZone is the zone of times that do not record one. ShootTimeZone,
+	// when set, is the zone the files were taken in, date folders use its
+	// local time instead of the zone each file records.
+	TimeZone      *time.Location
+	ShootTimeZone *time.Location
+
+	// Filters are the include and exclude rules of each operation, by
+	// catalog kind. Operations without a filter handle every file.
+	Filters map[string]*filters.Filter
+
+	// ReadJobs and WriteJobs bound how many files are decoded and transferred at once.
+	ReadJobs  int
+	WriteJobs int
 }
 
 type Service struct {
 	logger   *zap.Logger
 	criteria SortCriteria
 	files    fileManager
-	stats    *runtimestats.Stats
+	catalog  catalogStore
+	uploader upload.Uploader
+	stats    statsManager
+	resolver *timestamps.Resolver
+
+	// index is loaded by the first operation that handles duplicates.
+	index *hashIndex
+	// failures are the files that could not be processed, collected as jobs complete.
+	failures []Failure
 }
 
 type fileManager interface {
@@ -34,239 +93,349 @@ type fileManager interface {
 	GetFilesRecursivelyInPath(path string) ([]string, error)
 	DoesFileExist(path string) (bool, error)
 	DoesPathExist(path string) (bool, error)
-	MoveFile(sourcePath, destinationPath string) error
-	CopyFile(sourcePath, destinationPath string) error
+	GetFileInfo(path string) (os.FileInfo, error)
+	MoveFile(ctx context.Context, sourcePath, destinationPath string) (string, error)
+	CopyFile(ctx context.Context, sourcePath, destinationPath string) (string, error)
+	LinkFile(existingPath, destinationPath string) error
+	RemoveFile(path string) error
+	RecordChecksum(rootPath, filePath, checksum string) error
+	RemoveChecksum(rootPath, filePath string) error
+	FlushChecksums() error
+	HashFile(path string) (string, error)
+}
+
+// mediaData is the metadata shared by photos and videos.
+type mediaData interface {
+	GetFileName() string
+	GetFilePath() string
+	GetCameraModel() string
+	GetCameraSerial() string
+	GetTimestamp() time.Time
+	GetCreateDate() time.Time
+	GetTimeZoneSource() string
+}
+
+type catalogStore interface {
+	Get(sourcePath string, size int64, modTime time.Time) (catalog.Entry, bool, error)
+	Put(entry catalog.Entry) error
+	Entries(fn func(catalog.Entry) error) error
+	Hashes(fn func(catalog.FileHash) error) error
+	PutHashes(hashes []catalog.FileHash) error
+	DeleteHashes(paths []string) error
+	PutJournal(entry catalog.JournalEntry) error
+	DeleteJournal(entry catalog.JournalEntry) error
+	Journal(fn func(catalog.JournalEntry) error) error
 }
 
 type statsManager interface {
 	IncrementCounter(name string)
+	AddToCounter(name string, delta int)
 }
 
 func NewService(
 	logging *zap.Logger,
 	files fileManager,
 	sortingCriteria SortCriteria,
-	stats *runtimestats.Stats,
+	catalog catalogStore,
+	uploader upload.Uploader,
+	stats statsManager,
 ) *Service {
 	return &Service{
 		logger:   logging,
 		files:    files,
 		criteria: sortingCriteria,
+		catalog:  catalog,
+		uploader: uploader,
 		stats:    stats,
+		resolver: timestamps.NewResolver(sortingCriteria.TimestampSources, sortingCriteria.TimeZone),
 	}
 }
 
-// ImportRawFiles imports raw files from the raw path to the local path based on the last import date.
-func (s *Service) ImportRawFiles(lastImportDate time.Time) (time.Time, error) {
-	files, err := s.files.GetFilesRecursivelyInPath(s.criteria.RawPath)
+// ImportRawFiles imports raw files from the raw path to the local path, skipping files the catalog has already imported.
+func (s *Service) ImportRawFiles(ctx context.Context) error {
+	imported, err := s.run(ctx, s.importOperation())
 	if err != nil {
-		return time.Time{}, fmt.Errorf("failed to get files recursively in path [%s]: %w", s.criteria.RawPath, err)
+		return err
 	}
-	s.logger.Info("Found files for import", zap.Int("file_count", len(files)))
-	s.stats.RawFilesChecked += len(files)
-
-	imageTypes := images.GetImageTypes()
-
-	imageFiles := []string{}
-
-	for _, file := range files {
-		if !fileTypeIsInList(file, imageTypes) {
-			s.logger.Debug("Skipping non-image file", zap.String("file", file))
-			continue
-		}
-		imageFiles = append(imageFiles, file)
-	}
-	s.logger.Info("Filtered image files for import", zap.Int("image_file_count", len(imageFiles)))
-	s.stats.RawFilesFound += len(imageFiles)
-
-	var filesChecked int
-	var newestTime time.Time
-	for _, file := range imageFiles {
-		filesChecked++
-		logMsg := fmt.Sprintf("%d files remaining", len(imageFiles)-filesChecked)
-
-		// get photo data
-		imgData, err := images.GetPhoto(nil, file)
-		if err != nil {
-			return time.Time{}, fmt.Errorf("failed to get photo data for file [%s]: %w", file, err)
-		}
-
-		// get timestamp and if before last import date, skip
-		imgTime := imgData.GetTimestamp()
-		if imgTime.Before(lastImportDate) || imgTime.Equal(lastImportDate) {
-			s.logger.Debug(logMsg, zap.String("file", file), zap.Bool("imported", false))
-			continue
-		}
-
-		// create the new path of format <localRawPath>/<year>-<month>-<day>/<filename>
-		destPath := generateRawImportDestinationPath(s.criteria.LocalRawPath, imgData.GetFileName(), imgTime)
 
-		// copy the file to the new location
-		err = s.files.CopyFile(file, destPath)
-		if err != nil {
-			return time.Time{}, fmt.Errorf("failed to copy file [%s] to [%s]: %w", file, destPath, err)
-		}
+	s.logger.Info("Import raw files completed", zap.Int("imported_files_count", imported))
+	return nil
+}
 
-		// update newest time
-		if imgTime.After(newestTime) {
-			newestTime = imgTime
-		}
-		s.logger.Debug(logMsg, zap.String("file", file), zap.Bool("imported", true))
-		s.stats.RawFilesImported++
+func (s *Service) BackupLocalRawFiles(ctx context.Context) error {
+	backedUp, err := s.run(ctx, s.rawBackupOperation())
+	if err != nil {
+		return err
 	}
 
-	s.logger.Info("Import raw files completed", zap.Int("imported_files_count", s.stats.RawFilesImported), zap.Int("file_count", len(files)))
-	return newestTime, nil
+	s.logger.Info("Backup of local raw files completed", zap.Int("file_count", backedUp))
+	return nil
 }
 
-func (s *Service) BackupLocalRawFiles() error {
-	files, err := s.files.GetFilesRecursivelyInPath(s.criteria.LocalRawPath)
+func (s *Service) BackupEditedFiles(ctx context.Context) error {
+	backedUp, err := s.run(ctx, s.editedBackupOperation())
 	if err != nil {
-		return fmt.Errorf("failed to get files recursively in path [%s]: %w", s.criteria.LocalRawPath, err)
+		return err
 	}
-	s.logger.Info("Found files for import", zap.Int("file_count", len(files)))
-	s.stats.LocalRawFilesChecked += len(files)
 
-	imageTypes := images.GetImageTypes()
+	s.logger.Info("Backup of local edited files completed", zap.Int("file_count", backedUp))
+	return nil
+}
 
-	imageFiles := []string{}
+// UploadEditedFiles uploads edited images from the local edited path that the uploader does not already have.
+func (s *Service) UploadEditedFiles(ctx context.Context) error {
+	if s.uploader == nil {
+		return fmt.Errorf("no uploader configured")
+	}
 
-	for _, file := range files {
-		if !fileTypeIsInList(file, imageTypes) {
-			s.logger.Debug("Skipping non-image file", zap.String("file", file))
-			continue
-		}
-		imageFiles = append(imageFiles, file)
+	uploaded, err := s.run(ctx, s.uploadOperation())
+	if err != nil {
+		return err
 	}
-	s.logger.Info("Filtered image files for import", zap.Int("image_file_count", len(imageFiles)))
-	s.stats.LocalRawFilesFound += len(imageFiles)
 
-	var filesChecked int
-	for _, file := range imageFiles {
-		filesChecked++
-		logMsg := fmt.Sprintf("%d files remaining", len(imageFiles)-filesChecked)
+	s.logger.Info("Upload of local edited files completed", zap.Int("file_count", uploaded))
+	return nil
+}
 
-		// get photo data
-		imgData, err := images.GetPhoto(nil, file)
-		if err != nil {
-			return fmt.Errorf("failed to get photo data for file [%s]: %w", file, err)
-		}
+func (s *Service) importOperation() operation {
+	return operation{
+		name:           "import",
+		doneField:      "imported",
+		kind:           catalog.KindImport,
+		action:         ActionCopy,
+		sourcePath:     s.criteria.RawPath,
+		manifestRoot:   s.criteria.LocalRawPath,
+		fileTypes:      s.criteria.FileTypes,
+		checkedCounter: runtimestats.RawFilesChecked,
+		foundCounter:   runtimestats.RawFilesFound,
+		transferCounters: map[string]string{
+			ActionCopy: runtimestats.RawFilesImported,
+			ActionLink: runtimestats.DuplicatesLinked,
+		},
+		destination: func(media mediaData) string {
+			return filepath.Join(s.criteria.LocalRawPath, s.criteria.ImportTemplate.Render(templateFields(media)))
+		},
+		reservations: newReservations(),
+		groups:       true,
+	}
+}
 
-		// create the new path of format <backupPath>/<year>/<month>/<day><hour><minute><second>_<filename>
-		imgTime := imgData.GetTimestamp()
-		destPath := generateRawBackupDestinationPath(s.criteria.BackupPath, imgData.GetFileName(), imgTime)
+func (s *Service) rawBackupOperation() operation {
+	return operation{
+		name:           "raw backup",
+		doneField:      "backed_up",
+		kind:           catalog.KindRawBackup,
+		action:         s.backupAction(),
+		sourcePath:     s.criteria.LocalRawPath,
+		manifestRoot:   s.criteria.BackupPath,
+		fileTypes:      s.criteria.FileTypes,
+		checkedCounter: runtimestats.LocalRawFilesChecked,
+		foundCounter:   runtimestats.LocalRawFilesFound,
+		transferCounters: map[string]string{
+			ActionCopy: runtimestats.LocalRawFilesCopied,
+			ActionMove: runtimestats.LocalRawFilesMoved,
+			ActionLink: runtimestats.DuplicatesLinked,
+		},
+		destination: func(media mediaData) string {
+			return filepath.Join(s.criteria.BackupPath, s.criteria.RawBackupTemplate.Render(templateFields(media)))
+		},
+		reservations: newReservations(),
+		groups:       true,
+	}
+}
 
-		// check if the file with the new name already exists at the destination
-		exists, err := s.files.DoesFileExist(destPath)
-		if err != nil {
-			return fmt.Errorf("failed to check if file exists at destination [%s]: %w", destPath, err)
-		}
-		if exists {
-			s.logger.Debug(logMsg, zap.String("file", file), zap.Bool("backed_up", false), zap.String("reason", "file already exists at destination"))
-			continue
-		}
+func (s *Service) editedBackupOperation() operation {
+	return operation{
+		name:           "edited backup",
+		doneField:      "backed_up",
+		kind:           catalog.KindEditedBackup,
+		action:         s.backupAction(),
+		sourcePath:     s.criteria.LocalEditedPath,
+		manifestRoot:   s.criteria.BackupPath,
+		fileTypes:      s.criteria.FileTypes,
+		checkedCounter: runtimestats.LocalEditedFilesChecked,
+		foundCounter:   runtimestats.LocalEditedFilesFound,
+		transferCounters: map[string]string{
+			ActionCopy: runtimestats.LocalEditedFilesCopied,
+			ActionMove: runtimestats.LocalEditedFilesMoved,
+			ActionLink: runtimestats.DuplicatesLinked,
+		},
+		destination: func(media mediaData) string {
+			return filepath.Join(s.criteria.BackupPath, s.criteria.EditedBackupTemplate.Render(templateFields(media)))
+		},
+		reservations: newReservations(),
+		groups:       true,
+	}
+}
 
-		if s.criteria.CopyFiles {
-			// copy the file to the new location
-			err = s.files.CopyFile(file, destPath)
+func (s *Service) uploadOperation() operation {
+	return operation{
+		name:           "upload",
+		doneField:      "uploaded",
+		kind:           catalog.KindUpload,
+		action:         ActionUpload,
+		sourcePath:     s.criteria.LocalEditedPath,
+		fileTypes:      s.editedFileTypes(),
+		checkedCounter: runtimestats.ToUploadFilesChecked,
+		foundCounter:   runtimestats.ToUploadFilesFound,
+		transferCounters: map[string]string{
+			ActionUpload: runtimestats.ToUploadFilesUploaded,
+		},
+		destination: func(media mediaData) string {
+			return s.criteria.UploadTemplate.Render(templateFields(media))
+		},
+		isDone: func(name string) (bool, string, error) {
+			uploaded, err := s.uploader.IsUploaded(name)
 			if err != nil {
-				return fmt.Errorf("failed to copy file [%s] to [%s]: %w", file, destPath, err)
+				return false, "", fmt.Errorf("failed to check if file [%s] is uploaded: %w", name, err)
 			}
-			s.stats.LocalRawFilesCopied++
-		} else if s.criteria.MoveFiles {
-			// move the file to the new location
-			err = s.files.MoveFile(file, destPath)
-			if err != nil {
-				return fmt.Errorf("failed to move file [%s] to [%s]: %w", file, destPath, err)
-			}
-			s.stats.LocalRawFilesMoved++
-		} else {
-			s.logger.Warn("No file operation specified (neither move nor copy)", zap.String("file", file))
-			continue
+			return uploaded, "file already uploaded", nil
+		},
+	}
+}
+
+// editedFileTypes returns the file types to sort that edited photos are
+// exported in, leaving out raws and videos.
+func (s *Service) editedFileTypes() []string {
+	types := []string{}
+	for _, fileType := range s.criteria.FileTypes {
+		if fileTypeIsInList("."+fileType, images.GetEditedTypes()) {
+			types = append(types, fileType)
 		}
+	}
+	return types
+}
 
-		s.logger.Debug(logMsg, zap.String("file", file), zap.Bool("backed_up", true))
+// operationForKind returns the operation that writes catalog destinations of the given kind.
+func (s *Service) operationForKind(kind string) (operation, error) {
+	switch kind {
+	case catalog.KindImport:
+		return s.importOperation(), nil
+	case catalog.KindRawBackup:
+		return s.rawBackupOperation(), nil
+	case catalog.KindEditedBackup:
+		return s.editedBackupOperation(), nil
+	case catalog.KindUpload:
+		if s.uploader == nil {
+			return operation{}, fmt.Errorf("no uploader configured")
+		}
+		return s.uploadOperation(), nil
+	default:
+		return operation{}, fmt.Errorf("unknown operation [%s]", kind)
 	}
+}
 
-	s.logger.Info("Backup of local raw files completed", zap.Int("file_count", s.stats.LocalRawFilesCopied+s.stats.LocalRawFilesMoved))
-	return nil
+// backupAction returns whether backups copy or move files, or "" if neither is configured.
+func (s *Service) backupAction() string {
+	switch {
+	case s.criteria.CopyFiles:
+		return ActionCopy
+	case s.criteria.MoveFiles:
+		return ActionMove
+	default:
+		return ""
+	}
 }
 
-func (s *Service) BackupEditedFiles() error {
-	files, err := s.files.GetFilesRecursivelyInPath(s.criteria.LocalEditedPath)
+// lookupEntry returns the catalog entry for the file, starting a fresh one when
+// the file is unknown or has changed since it was catalogued.
+func (s *Service) lookupEntry(file string) (catalog.Entry, error) {
+	info, err := s.files.GetFileInfo(file)
 	if err != nil {
-		return fmt.Errorf("failed to get files recursively in path [%s]: %w", s.criteria.LocalEditedPath, err)
+		return catalog.Entry{}, fmt.Errorf("failed to get file info for file [%s]: %w", file, err)
 	}
-	s.logger.Info("Found files for import", zap.Int("file_count", len(files)))
-	s.stats.LocalEditedFilesChecked += len(files)
-
-	imageTypes := images.GetImageTypes()
-
-	imageFiles := []string{}
 
-	for _, file := range files {
-		if !fileTypeIsInList(file, imageTypes) {
-			s.logger.Debug("Skipping non-image file", zap.String("file", file))
-			continue
-		}
-		imageFiles = append(imageFiles, file)
+	entry, found, err := s.catalog.Get(file, info.Size(), info.ModTime())
+	if err != nil {
+		return catalog.Entry{}, fmt.Errorf("failed to get catalog entry for file [%s]: %w", file, err)
+	}
+	if found {
+		return entry, nil
 	}
-	s.logger.Info("Filtered image files for import", zap.Int("image_file_count", len(imageFiles)))
-	s.stats.LocalEditedFilesFound += len(imageFiles)
 
-	var filesChecked int
-	for _, file := range imageFiles {
-		filesChecked++
-		logMsg := fmt.Sprintf("%d files remaining", len(imageFiles)-filesChecked)
+	return catalog.Entry{
+		SourcePath: file,
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+	}, nil
+}
 
-		// get photo data
-		imgData, err := images.GetPhoto(nil, file)
-		if err != nil {
-			return fmt.Errorf("failed to get photo data for file [%s]: %w", file, err)
-		}
+// recordDestination adds the destination the action took the file to to its
+// catalog entry and, for destinations on disk, to the checksum manifest under
+// rootPath.
+func (s *Service) recordDestination(entry catalog.Entry, media resolvedMedia, kind, action, rootPath, destPath, checksum string) error {
+	return s.recordEntry(mediaEntry(entry, media), kind, action, rootPath, destPath, checksum)
+}
 
-		// create the new path of format <backupPath>/<year>/<month>/<day><hour><minute><second>_<filename>
-		imgTime := imgData.GetTimestamp()
-		destPath := generateEditedBackupDestinationPath(s.criteria.BackupPath, imgData.GetFileName(), imgTime)
+// mediaEntry is the file's catalog entry with what was read from its metadata.
+func mediaEntry(entry catalog.Entry, media resolvedMedia) catalog.Entry {
+	entry.Timestamp = media.GetTimestamp()
+	entry.TimestampSource = media.source
+	entry.ClockOffset = media.offset
+	entry.Metadata = photoMetadata(media)
+	entry.CameraModel = media.GetCameraModel()
+	return entry
+}
 
-		// check if the file with the new name already exists at the destination
-		exists, err := s.files.DoesFileExist(destPath)
+func (s *Service) recordEntry(entry catalog.Entry, kind, action, rootPath, destPath, checksum string) error {
+	if rootPath != "" {
+		err := s.files.RecordChecksum(rootPath, destPath, checksum)
 		if err != nil {
-			return fmt.Errorf("failed to check if file exists at destination [%s]: %w", destPath, err)
-		}
-		if exists {
-			s.logger.Debug(logMsg, zap.String("file", file), zap.Bool("backed_up", false), zap.String("reason", "file already exists at destination"))
-			continue
+			return fmt.Errorf("failed to record checksum for file [%s]: %w", destPath, err)
 		}
+	}
 
-		if s.criteria.CopyFiles {
-			// copy the file to the new location
-			err = s.files.CopyFile(file, destPath)
-			if err != nil {
-				return fmt.Errorf("failed to copy file [%s] to [%s]: %w", file, destPath, err)
-			}
-			s.stats.LocalEditedFilesCopied++
-		} else if s.criteria.MoveFiles {
-			// move the file to the new location
-			err = s.files.MoveFile(file, destPath)
-			if err != nil {
-				return fmt.Errorf("failed to move file [%s] to [%s]: %w", file, destPath, err)
-			}
-			s.stats.LocalEditedFilesMoved++
-		} else {
-			s.logger.Warn("No file operation specified (neither move nor copy)", zap.String("file", file))
-			continue
-		}
+	if checksum != "" {
+		entry.Checksum = checksum
+	} else {
+		checksum = entry.Checksum
+	}
+	entry.AddDestination(kind, action, destPath, checksum)
 
-		s.logger.Debug(logMsg, zap.String("file", file), zap.Bool("backed_up", true))
+	err := s.catalog.Put(entry)
+	if err != nil {
+		return fmt.Errorf("failed to update catalog for file [%s]: %w", entry.SourcePath, err)
 	}
+	return nil
+}
 
-	s.logger.Info("Backup of local edited files completed", zap.Int("file_count", s.stats.LocalEditedFilesCopied+s.stats.LocalEditedFilesMoved))
+// forgetChecksum removes a file moved out of the source tree from the
+// checksum manifest under sourceRoot, so the manifest only lists files that
+// are still there.
+func (s *Service) forgetChecksum(sourceRoot, file string) error {
+	if sourceRoot == "" {
+		return nil
+	}
+	if err := s.files.RemoveChecksum(sourceRoot, file); err != nil {
+		return fmt.Errorf("failed to remove checksum for moved file [%s]: %w", file, err)
+	}
 	return nil
 }
 
+// flushChecksums writes the checksum manifest changes of a run once it ends,
+// keeping the run's own error when it has one.
+func (s *Service) flushChecksums(err error) error {
+	flushErr := s.files.FlushChecksums()
+	switch {
+	case flushErr == nil:
+		return err
+	case err == nil:
+		return fmt.Errorf("failed to write checksum manifests: %w", flushErr)
+	default:
+		s.logger.Error("Failed to write checksum manifests", zap.Error(flushErr))
+		return err
+	}
+}
+
+// checksumFailed records a copy whose destination did not match its source, the source is left untouched.
+func (s *Service) checksumFailed(file, destPath string, err error) {
+	s.logger.Error("Checksum verification failed, file skipped", zap.String("file", file), zap.String("dest_path", destPath), zap.Error(err))
+	s.stats.IncrementCounter(runtimestats.ChecksumErrors)
+}
+
 func fileTypeIsInList(filePath string, fileTypes []string) bool {
 	for _, fileType := range fileTypes {
+		fileType = strings.TrimPrefix(fileType, ".")
 		if len(filePath) >= len(fileType)+1 && strings.EqualFold(filePath[len(filePath)-len(fileType)-1:], "."+fileType) {
 			return true
 		}
@@ -274,20 +443,97 @@ func fileTypeIsInList(filePath string, fileTypes []string) bool {
 	return false
 }
 
-func generateRawImportDestinationPath(basePath, fileName string, timestamp time.Time) string {
-	return fmt.Sprintf("%s/%d-%02d-%02d/%s", basePath, timestamp.Year(), timestamp.Month(), timestamp.Day(), fileName)
+var digitsPattern = regexp.MustCompile(`\d+`)
+
+// unknownValue is the path template value of anything a file does not record.
+const unknownValue = "unknown"
+
+// templateFields returns the path template values for the file. Values the
+// file does not record are "unknown".
+func templateFields(media mediaData) pathtemplate.Fields {
+	timestamp := media.GetTimestamp()
+	fileName := media.GetFileName()
+	ext := filepath.Ext(fileName)
+	name := strings.TrimSuffix(fileName, ext)
+
+	camera := media.GetCameraModel()
+	if camera == "" {
+		camera = unknownValue
+	}
+
+	fields := pathtemplate.Fields{
+		pathtemplate.TokenYear:      fmt.Sprintf("%d", timestamp.Year()),
+		pathtemplate.TokenMonth:     fmt.Sprintf("%02d", timestamp.Month()),
+		pathtemplate.TokenDay:       fmt.Sprintf("%02d", timestamp.Day()),
+		pathtemplate.TokenHour:      fmt.Sprintf("%02d", timestamp.Hour()),
+		pathtemplate.TokenMinute:    fmt.Sprintf("%02d", timestamp.Minute()),
+		pathtemplate.TokenSecond:    fmt.Sprintf("%02d", timestamp.Second()),
+		pathtemplate.TokenDate:      timestamp.Format(time.DateOnly),
+		pathtemplate.TokenCamera:    camera,
+		pathtemplate.TokenFileName:  fileName,
+		pathtemplate.TokenName:      name,
+		pathtemplate.TokenExt:       ext,
+		pathtemplate.TokenSeq:       sequenceNumber(name),
+		pathtemplate.TokenSourceDir: filepath.Base(filepath.Dir(media.GetFilePath())),
+		pathtemplate.TokenLens:      unknownValue,
+		pathtemplate.TokenFocal:     unknownValue,
+		pathtemplate.TokenAperture:  unknownValue,
+		pathtemplate.TokenShutter:   unknownValue,
+		pathtemplate.TokenISO:       unknownValue,
+		pathtemplate.TokenRating:    unknownValue,
+	}
+
+	metadata := photoMetadata(media)
+	if metadata == nil {
+		return fields
+	}
+	if metadata.LensModel != nil {
+		fields[pathtemplate.TokenLens] = strings.ToLower(*metadata.LensModel)
+	}
+	if metadata.FocalLength != nil {
+		fields[pathtemplate.TokenFocal] = strconv.FormatFloat(*metadata.FocalLength, 'f', -1, 64) + "mm"
+	}
+	if metadata.Aperture != nil {
+		fields[pathtemplate.TokenAperture] = "f" + strconv.FormatFloat(*metadata.Aperture, 'f', -1, 64)
+	}
+	if metadata.ExposureTime != nil {
+		fields[pathtemplate.TokenShutter] = shutterSpeed(*metadata.ExposureTime)
+	}
+	if metadata.ISO != nil {
+		fields[pathtemplate.TokenISO] = strconv.Itoa(*metadata.ISO)
+	}
+	if metadata.Rating != nil {
+		fields[pathtemplate.TokenRating] = strconv.Itoa(*metadata.Rating)
+	}
+	return fields
 }
 
-func generateRawBackupDestinationPath(basePath, fileName string, timestamp time.Time) string {
-	return fmt.Sprintf("%s/raw/year%d/month%02d/day%02d/%02d%02d%02d_%s", basePath,
-		timestamp.Year(), timestamp.Month(), timestamp.Day(),
-		timestamp.Hour(), timestamp.Minute(), timestamp.Second(),
-		fileName)
+// photoMetadata returns the metadata of a photo, or nil for other files.
+func photoMetadata(media mediaData) *images.Metadata {
+	if resolved, ok := media.(resolvedMedia); ok {
+		media = resolved.mediaData
+	}
+	photo, ok := media.(images.ImageData)
+	if !ok {
+		return nil
+	}
+	metadata := photo.GetMetadata()
+	return &metadata
+}
+
+// shutterSpeed formats an exposure time for a path, 1/250s becomes 1-250s.
+func shutterSpeed(seconds float64) string {
+	if seconds < 1 {
+		return fmt.Sprintf("1-%.0fs", 1/seconds)
+	}
+	return strconv.FormatFloat(seconds, 'f', -1, 64) + "s"
 }
 
-func generateEditedBackupDestinationPath(basePath, fileName string, timestamp time.Time) string {
-	return fmt.Sprintf("%s/edited/year%d/month%02d/day%02d/%02d%02d%02d_%s", basePath,
-		timestamp.Year(), timestamp.Month(), timestamp.Day(),
-		timestamp.Hour(), timestamp.Minute(), timestamp.Second(),
-		fileName)
+// sequenceNumber returns the camera's frame counter, the last run of digits in a file name.
+func sequenceNumber(name string) string {
+	matches := digitsPattern.FindAllString(name, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1]
 }
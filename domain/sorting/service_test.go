@@ -0,0 +1,74 @@
+package sorting
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/domain/upload"
+)
+
+func TestUploadEditedFilesSkipsRawsAndVideos(t *testing.T) {
+	s, _, trees := newTestService(t, SortCriteria{})
+	uploads := t.TempDir()
+	s.uploader = upload.NewDirectoryUploader(uploads)
+
+	for _, name := range []string{"IMG_20230714_093015.jpg", "IMG_20230714_093016.cr2", "IMG_20230714_093017.cr3", "VID_20230714_093018.mp4"} {
+		writeFile(t, filepath.Join(trees.edited, name), name)
+	}
+
+	if err := s.UploadEditedFiles(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"IMG_20230714_093015.jpg": "IMG_20230714_093015.jpg",
+		"IMG_20230714_093016.cr2": "",
+		"IMG_20230714_093017.cr3": "",
+		"VID_20230714_093018.mp4": "",
+	} {
+		if got := readFile(t, filepath.Join(uploads, "2023", name)); got != want {
+			t.Errorf("uploaded %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestImportKeepsEntriesOfReusedFileNames(t *testing.T) {
+	s, store, trees := newTestService(t, SortCriteria{})
+	source := filepath.Join(trees.raw, "IMG_20230714_093015.jpg")
+
+	writeFile(t, source, "first card")
+	if err := s.ImportRawFiles(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// a reformatted card reuses the name for a different file
+	writeFile(t, source, "second card, another photo")
+	if err := os.Chtimes(source, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ImportRawFiles(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	dests := map[string]bool{}
+	err := store.Entries(func(entry catalog.Entry) error {
+		if entry.SourcePath == source {
+			dests[entry.DestinationPath(catalog.KindImport)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		filepath.Join(trees.localRaw, "2023", "IMG_20230714_093015.jpg"):   true,
+		filepath.Join(trees.localRaw, "2023", "IMG_20230714_093015_1.jpg"): true,
+	}
+	if !maps.Equal(dests, want) {
+		t.Errorf("catalogued imports = %v, want %v", dests, want)
+	}
+}
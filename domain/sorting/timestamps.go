@@ -0,0 +1,103 @@
+package sorting
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/downing/media-manager/domain/images"
+	"github.com/downing/media-manager/domain/timestamps"
+	"github.com/downing/media-manager/domain/video"
+	"go.uber.org/zap"
+)
+
+// resolvedMedia is a file's metadata with the timestamp the resolver chain
+// chose, corrected for the camera's clock, in place of the embedded one.
+type resolvedMedia struct {
+	mediaData
+	timestamp time.Time
+	// source is "" when no source had a usable time.
+	source string
+	// offset is the clock correction included in timestamp.
+	offset time.Duration
+}
+
+func (m resolvedMedia) GetTimestamp() time.Time {
+	return m.timestamp
+}
+
+// unreadableMedia stands in for a file whose metadata could not be decoded,
+// such as a screenshot or a corrupt photo.
+type unreadableMedia struct {
+	fileName string
+	filePath string
+}
+
+func (m unreadableMedia) GetFileName() string       { return m.fileName }
+func (m unreadableMedia) GetFilePath() string       { return m.filePath }
+func (m unreadableMedia) GetCameraModel() string    { return "" }
+func (m unreadableMedia) GetCameraSerial() string   { return "" }
+func (m unreadableMedia) GetTimestamp() time.Time   { return time.Time{} }
+func (m unreadableMedia) GetCreateDate() time.Time  { return time.Time{} }
+func (m unreadableMedia) GetTimeZoneSource() string { return "" }
+
+// getMediaData reads the metadata of a photo or video file and resolves when
+// it was taken, correcting the time for the camera's clock and moving it to
+// the shoot time zone when one is set. A file that cannot
+// be decoded does not stop the run, its time comes from the sources that do
+// not need its metadata.
+func (s *Service) getMediaData(file string) resolvedMedia {
+	var media mediaData
+	var err error
+	if fileTypeIsInList(file, video.GetVideoTypes()) {
+		media, err = video.GetVideo(nil, file)
+	} else {
+		media, err = images.GetPhoto(nil, file)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to read media metadata", zap.String("file", file), zap.Error(err))
+		media = unreadableMedia{fileName: filepath.Base(file), filePath: file}
+	}
+
+	zone := media.GetTimeZoneSource()
+	timestamp, source := s.resolver.Resolve(file, timestamps.Embedded{
+		Original: media.GetTimestamp(),
+		Created:  media.GetCreateDate(),
+		Zoned:    zone != "" && zone != video.ZoneMovieHeader,
+		UTC:      zone == video.ZoneMovieHeader,
+	})
+	switch source {
+	case "":
+		s.logger.Warn("No usable timestamp found", zap.String("file", file), zap.Strings("sources", s.criteria.TimestampSources))
+	case timestamps.SourceExif:
+		s.logger.Debug("Resolved timestamp", zap.String("file", file), zap.String("source", source), zap.String("zone_source", zone),
+			zap.Time("timestamp", timestamp))
+	default:
+		s.logger.Info("Resolved timestamp from fallback source", zap.String("file", file), zap.String("source", source), zap.Time("timestamp", timestamp))
+	}
+	resolved := resolvedMedia{mediaData: media, timestamp: timestamp, source: source}
+	if source == "" {
+		return resolved
+	}
+
+	resolved.offset = s.criteria.ClockOffsets.Offset(media.GetCameraModel(), media.GetCameraSerial(), timestamp)
+	if resolved.offset != 0 {
+		resolved.timestamp = timestamp.Add(resolved.offset)
+		s.logger.Debug("Corrected camera clock", zap.String("file", file), zap.String("camera", media.GetCameraModel()),
+			zap.Duration("offset", resolved.offset), zap.Time("timestamp", resolved.timestamp))
+	}
+	if s.criteria.ShootTimeZone != nil {
+		resolved.timestamp = resolved.timestamp.In(s.criteria.ShootTimeZone)
+	}
+	return resolved
+}
+
+// quarantinePath is where a file with no usable timestamp goes instead of its
+// dated destination, the quarantine directory of the operation's destination
+// tree unless it is an absolute path.
+func (s *Service) quarantinePath(op operation, file string) string {
+	dir := s.criteria.QuarantineDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(op.manifestRoot, dir)
+	}
+	return filepath.Join(dir, filepath.Base(file))
+}
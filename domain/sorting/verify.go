@@ -0,0 +1,117 @@
+package sorting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"go.uber.org/zap"
+)
+
+const (
+	ProblemMissing  = "missing"
+	ProblemMismatch = "checksum mismatch"
+)
+
+// VerifyResult is the outcome of checking catalogued copies against their checksums.
+type VerifyResult struct {
+	Checked  int
+	Problems []VerifyProblem
+}
+
+type VerifyProblem struct {
+	SourcePath  string
+	Kind        string
+	Destination string
+	Problem     string
+}
+
+// VerifyDestinations re-hashes every catalogued copy on disk, taken since the
+// given time, and reports the ones that are missing or no longer match. A copy
+// that was later moved on, such as an import moved to the backup, is checked
+// at its latest destination only.
+func (s *Service) VerifyDestinations(ctx context.Context, since time.Time) (VerifyResult, error) {
+	var result VerifyResult
+	movedAt, err := s.movedSources()
+	if err != nil {
+		return result, fmt.Errorf("failed to verify catalog: %w", err)
+	}
+
+	err = s.catalog.Entries(func(entry catalog.Entry) error {
+		if entry.Timestamp.Before(since) {
+			return nil
+		}
+		for _, dest := range entry.Destinations {
+			if dest.Kind == catalog.KindUpload || dest.Checksum == "" {
+				continue
+			}
+			if moved, ok := movedAt[dest.Path]; ok && !dest.RecordedAt.After(moved) {
+				s.logger.Debug("Skipping file moved on to a later destination", zap.String("file", dest.Path))
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			result.Checked++
+
+			problem, err := s.verifyDestination(dest)
+			if err != nil {
+				return err
+			}
+			if problem == "" {
+				s.logger.Debug("Verified file", zap.String("file", dest.Path))
+				continue
+			}
+
+			s.logger.Warn("Verification failed", zap.String("file", dest.Path), zap.String("problem", problem))
+			result.Problems = append(result.Problems, VerifyProblem{
+				SourcePath:  entry.SourcePath,
+				Kind:        dest.Kind,
+				Destination: dest.Path,
+				Problem:     problem,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to verify catalog: %w", err)
+	}
+
+	s.logger.Info("Verification completed", zap.Int("file_count", result.Checked), zap.Int("problem_count", len(result.Problems)))
+	return result, nil
+}
+
+// movedSources returns when each catalogued file that was moved to a
+// destination was last moved.
+func (s *Service) movedSources() (map[string]time.Time, error) {
+	movedAt := map[string]time.Time{}
+	err := s.catalog.Entries(func(entry catalog.Entry) error {
+		for _, dest := range entry.Destinations {
+			if dest.Action == ActionMove && dest.RecordedAt.After(movedAt[entry.SourcePath]) {
+				movedAt[entry.SourcePath] = dest.RecordedAt
+			}
+		}
+		return nil
+	})
+	return movedAt, err
+}
+
+func (s *Service) verifyDestination(dest catalog.Destination) (string, error) {
+	exists, err := s.files.DoesFileExist(dest.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if file exists [%s]: %w", dest.Path, err)
+	}
+	if !exists {
+		return ProblemMissing, nil
+	}
+
+	checksum, err := s.files.HashFile(dest.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file [%s]: %w", dest.Path, err)
+	}
+	if checksum != dest.Checksum {
+		return ProblemMismatch, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,36 @@
+package timestamps
+
+import "time"
+
+const (
+	SourceExif       = "exif"
+	SourceCreateDate = "create_date"
+	SourceXMP        = "xmp"
+	SourceFileName   = "filename"
+	SourceModTime    = "mtime"
+)
+
+// Embedded are the times a photo or video records about itself: when it was
+// taken, the EXIF DateTimeOriginal, and when it was written, the CreateDate.
+type Embedded struct {
+	Original time.Time
+	Created  time.Time
+	// Zoned means the times are in the zone the file was taken in, UTC that
+	// they are UTC with no record of that zone. Otherwise they are wall clock
+	// times in an unknown zone.
+	Zoned bool
+	UTC   bool
+}
+
+// Resolver picks the time a file was taken from the first source in its chain
+// that has a usable one. Times without a zone are taken to be in its zone.
+type Resolver struct {
+	sources []string
+	zone    *time.Location
+}
+
+// earliest and latestAhead bound a usable time, cameras with a flat clock
+// battery write 0001-01-01 or dates far in the future.
+var earliest = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const latestAhead = 24 * time.Hour
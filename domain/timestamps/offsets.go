@@ -0,0 +1,58 @@
+package timestamps
+
+import (
+	"strings"
+	"time"
+)
+
+// OffsetRule corrects the clock of a camera, picked by model, body serial or
+// both. From and To are the first and last days on the camera's clock the
+// rule applies to, either may be zero for an open range.
+type OffsetRule struct {
+	Camera string
+	Serial string
+	Offset time.Duration
+	From   time.Time
+	To     time.Time
+}
+
+// OffsetRules are the clock corrections for every camera, the first rule
+// that matches a photo is used.
+type OffsetRules []OffsetRule
+
+// Offset returns the correction for a time read from the given camera.
+func (r OffsetRules) Offset(camera, serial string, t time.Time) time.Duration {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	for _, rule := range r {
+		if rule.matches(camera, serial, day) {
+			return rule.Offset
+		}
+	}
+	return 0
+}
+
+func (r OffsetRule) matches(camera, serial string, day time.Time) bool {
+	if r.Camera != "" && !strings.EqualFold(r.Camera, camera) {
+		return false
+	}
+	if r.Serial != "" && r.Serial != serial {
+		return false
+	}
+	if !r.From.IsZero() && day.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && day.After(r.To) {
+		return false
+	}
+	return true
+}
+
+// ClockOffset is the correction that turns the time a camera recorded into
+// the actual time, to the second, comparing wall clocks so the time zones of
+// both are ignored.
+func ClockOffset(recorded, actual time.Time) time.Duration {
+	wall := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	}
+	return wall(actual).Sub(wall(recorded)).Round(time.Second)
+}
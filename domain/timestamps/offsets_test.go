@@ -0,0 +1,85 @@
+package timestamps
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOffsetRules(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	rules := OffsetRules{
+		{Serial: "012345", Offset: time.Minute},
+		{Camera: "Canon EOS R5", From: day(2023, 3, 26), To: day(2023, 10, 28), Offset: -time.Hour},
+		{Camera: "Canon EOS R5", Offset: 2 * time.Minute},
+		{Camera: "DC-S5", To: day(2022, 12, 31), Offset: 30 * time.Second},
+		{Camera: "X-T5", From: day(2024, 1, 1), Offset: -30 * time.Second},
+	}
+	paris := time.FixedZone("CEST", 2*60*60)
+	tests := []struct {
+		name           string
+		camera, serial string
+		t              time.Time
+		want           time.Duration
+	}{
+		{"serial of any camera", "Canon EOS R6", "012345", time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC), time.Minute},
+		{"first matching rule wins", "Canon EOS R5", "012345", time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC), time.Minute},
+		{"camera in range", "Canon EOS R5", "", time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC), -time.Hour},
+		{"camera case is ignored", "CANON EOS R5", "", time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC), -time.Hour},
+		{"first day of range", "Canon EOS R5", "", time.Date(2023, 3, 26, 0, 0, 0, 0, time.UTC), -time.Hour},
+		{"last day of range", "Canon EOS R5", "", time.Date(2023, 10, 28, 23, 59, 59, 0, time.UTC), -time.Hour},
+		{"day before range", "Canon EOS R5", "", time.Date(2023, 3, 25, 23, 59, 59, 0, time.UTC), 2 * time.Minute},
+		{"day after range", "Canon EOS R5", "", time.Date(2023, 10, 29, 0, 0, 0, 0, time.UTC), 2 * time.Minute},
+		{"day is read from the camera's clock", "Canon EOS R5", "", time.Date(2023, 10, 29, 0, 30, 0, 0, paris), 2 * time.Minute},
+		{"open start", "DC-S5", "", time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC), 30 * time.Second},
+		{"after open start", "DC-S5", "", time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC), 0},
+		{"open end", "X-T5", "", time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC), -30 * time.Second},
+		{"before open end", "X-T5", "", time.Date(2023, 12, 31, 12, 0, 0, 0, time.UTC), 0},
+		{"other serial", "Canon EOS R6", "999", time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC), 0},
+		{"unknown camera", "", "", time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.Offset(tt.camera, tt.serial, tt.t); got != tt.want {
+				t.Errorf("Offset(%q, %q, %v) = %v, want %v", tt.camera, tt.serial, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOffsetRulesSerialAndCamera(t *testing.T) {
+	rules := OffsetRules{{Camera: "Canon EOS R5", Serial: "012345", Offset: time.Minute}}
+	at := time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC)
+	if got := rules.Offset("Canon EOS R5", "012345", at); got != time.Minute {
+		t.Errorf("Offset() of the camera and serial = %v, want %v", got, time.Minute)
+	}
+	if got := rules.Offset("Canon EOS R5", "999", at); got != 0 {
+		t.Errorf("Offset() of another body = %v, want 0", got)
+	}
+	if got := rules.Offset("Canon EOS R6", "012345", at); got != 0 {
+		t.Errorf("Offset() of another model = %v, want 0", got)
+	}
+}
+
+func TestClockOffset(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		name             string
+		recorded, actual time.Time
+		want             time.Duration
+	}{
+		{"slow clock", time.Date(2023, 7, 14, 9, 28, 0, 0, time.UTC), time.Date(2023, 7, 14, 9, 30, 0, 0, time.UTC), 2 * time.Minute},
+		{"fast clock", time.Date(2023, 7, 14, 10, 30, 0, 0, time.UTC), time.Date(2023, 7, 14, 9, 30, 0, 0, time.UTC), -time.Hour},
+		{"zones are ignored", time.Date(2023, 7, 14, 9, 30, 0, 0, time.UTC), time.Date(2023, 7, 14, 9, 30, 0, 0, tokyo), 0},
+		{"rounded to the second", time.Date(2023, 7, 14, 9, 30, 0, 0, time.UTC), time.Date(2023, 7, 14, 9, 30, 10, 600_000_000, time.UTC), 11 * time.Second},
+		{"across midnight", time.Date(2023, 7, 14, 23, 59, 0, 0, time.UTC), time.Date(2023, 7, 15, 0, 1, 0, 0, time.UTC), 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClockOffset(tt.recorded, tt.actual); got != tt.want {
+				t.Errorf("ClockOffset(%v, %v) = %v, want %v", tt.recorded, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package timestamps
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/downing/media-manager/pkg/xmpfile"
+	"github.com/evanoberholster/imagemeta/xmp"
+)
+
+func NewResolver(sources []string, zone *time.Location) *Resolver {
+	if zone == nil {
+		zone = time.Local
+	}
+	return &Resolver{
+		sources: sources,
+		zone:    zone,
+	}
+}
+
+// Resolve returns the first usable time for the file, in the zone it was
+// taken in when known and otherwise in the resolver's zone, and the source it
+// came from, or an empty source when no source in the chain has one.
+func (r *Resolver) Resolve(path string, embedded Embedded) (time.Time, string) {
+	for _, source := range r.sources {
+		var t time.Time
+		switch source {
+		case SourceExif, SourceCreateDate:
+			t = embedded.Original
+			if source == SourceCreateDate {
+				t = embedded.Created
+			}
+			switch {
+			case embedded.UTC:
+				t = t.In(r.zone)
+			case !embedded.Zoned:
+				t = r.wallClock(t)
+			}
+		case SourceXMP:
+			// XMP dates without an offset are parsed as UTC
+			t = xmpTime(path)
+			if t.Location() == time.UTC {
+				t = r.wallClock(t)
+			}
+		case SourceFileName:
+			t = r.wallClock(fileNameTime(filepath.Base(path)))
+		case SourceModTime:
+			if info, err := os.Stat(path); err == nil {
+				t = info.ModTime().In(r.zone)
+			}
+		}
+		if usable(t) {
+			return t, source
+		}
+	}
+	return time.Time{}, ""
+}
+
+// wallClock reads the wall clock of t as a time in the resolver's zone.
+func (r *Resolver) wallClock(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), r.zone)
+}
+
+func usable(t time.Time) bool {
+	return !t.IsZero() && !t.Before(earliest) && t.Before(time.Now().Add(latestAhead))
+}
+
+// xmpTime reads the time taken from the file's .xmp sidecar, or from XMP
+// embedded near the start of the file.
+func xmpTime(path string) time.Time {
+	var t time.Time
+	xmpfile.Find(path, func(p xmpfile.Packet) bool {
+		t = parseXMPTime(p.XMP)
+		return usable(t)
+	})
+	return t
+}
+
+func parseXMPTime(x xmp.XMP) time.Time {
+	for _, t := range []time.Time{x.Exif.DateTimeOriginal, x.Exif.CreateDate, x.Basic.CreateDate} {
+		if usable(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// fileNamePattern matches the dates phones, screenshot tools and cloud
+// services put in file names, such as IMG_20230415_123456.jpg,
+// PXL_20230415_123456789.jpg and "Screenshot 2023-04-15 at 12.34.56.jpg",
+// with or without the time. PNG screenshots are not sorted at all.
+var fileNamePattern = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})[-_.]?(0[1-9]|1[0-2])[-_.]?(0[1-9]|[12]\d|3[01])(?:(?:[ _T-]|\sat\s)([01]\d|2[0-3])[-_.:]?([0-5]\d)[-_.:]?([0-5]\d)\d{0,3})?(?:\D|$)`)
+
+// fileNameTime returns the date and time in a file name, as a wall clock time like EXIF.
+func fileNameTime(name string) time.Time {
+	m := fileNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}
+	}
+	parts := make([]int, 6)
+	for i, value := range m[1:] {
+		parts[i], _ = strconv.Atoi(value)
+	}
+	t := time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, time.UTC)
+	if t.Day() != parts[2] {
+		return time.Time{}
+	}
+	return t
+}
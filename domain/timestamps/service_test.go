@@ -0,0 +1,158 @@
+package timestamps
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileNameTime(t *testing.T) {
+	tests := []struct {
+		name string
+		want time.Time
+	}{
+		{"IMG_20230415_123456.jpg", time.Date(2023, 4, 15, 12, 34, 56, 0, time.UTC)},
+		{"PXL_20230415_123456789.jpg", time.Date(2023, 4, 15, 12, 34, 56, 0, time.UTC)},
+		{"Screenshot 2023-04-15 at 12.34.56.jpg", time.Date(2023, 4, 15, 12, 34, 56, 0, time.UTC)},
+		{"VID-20230415-WA0001.mp4", time.Date(2023, 4, 15, 0, 0, 0, 0, time.UTC)},
+		{"2023-04-15T12-34-56.jpg", time.Date(2023, 4, 15, 12, 34, 56, 0, time.UTC)},
+		{"IMG_0001.CR3", time.Time{}},
+		{"IMG_20230231_123456.jpg", time.Time{}},
+		{"IMG_20231315_123456.jpg", time.Time{}},
+		{"DSC120230415.jpg", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fileNameTime(tt.name); !got.Equal(tt.want) {
+				t.Errorf("fileNameTime(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	paris := time.FixedZone("CEST", 2*60*60)
+	wall := time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC)
+	const sidecar = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:DateTimeOriginal="%s"/>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+	tests := []struct {
+		name     string
+		sources  []string
+		file     string
+		embedded Embedded
+		// xmp is the sidecar's DateTimeOriginal and modTime the file's, when set
+		xmp     string
+		modTime time.Time
+		want    time.Time
+		source  string
+	}{
+		{
+			name:     "zoned time keeps its zone",
+			sources:  []string{SourceExif},
+			embedded: Embedded{Original: time.Date(2023, 7, 14, 9, 30, 15, 0, paris), Zoned: true},
+			want:     time.Date(2023, 7, 14, 9, 30, 15, 0, paris),
+			source:   SourceExif,
+		},
+		{
+			name:     "UTC time moves to the default zone",
+			sources:  []string{SourceExif},
+			embedded: Embedded{Original: time.Date(2023, 7, 14, 7, 30, 15, 0, time.UTC), UTC: true},
+			want:     time.Date(2023, 7, 14, 16, 30, 15, 0, tokyo),
+			source:   SourceExif,
+		},
+		{
+			name:     "wall clock time is read in the default zone",
+			sources:  []string{SourceExif},
+			embedded: Embedded{Original: wall},
+			want:     time.Date(2023, 7, 14, 9, 30, 15, 0, tokyo),
+			source:   SourceExif,
+		},
+		{
+			name:     "create date",
+			sources:  []string{SourceExif, SourceCreateDate},
+			embedded: Embedded{Created: time.Date(2023, 7, 14, 9, 30, 15, 0, paris), Zoned: true},
+			want:     time.Date(2023, 7, 14, 9, 30, 15, 0, paris),
+			source:   SourceCreateDate,
+		},
+		{
+			name:     "flat battery date falls back to the file name",
+			sources:  []string{SourceExif, SourceFileName},
+			file:     "IMG_20230714_093015.jpg",
+			embedded: Embedded{Original: time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)},
+			want:     time.Date(2023, 7, 14, 9, 30, 15, 0, tokyo),
+			source:   SourceFileName,
+		},
+		{
+			name:     "future date is not usable",
+			sources:  []string{SourceExif},
+			embedded: Embedded{Original: time.Now().AddDate(1, 0, 0)},
+		},
+		{
+			name:    "XMP time with an offset keeps it",
+			sources: []string{SourceXMP},
+			xmp:     "2023-07-14T09:30:15+02:00",
+			want:    time.Date(2023, 7, 14, 9, 30, 15, 0, paris),
+			source:  SourceXMP,
+		},
+		{
+			name:    "XMP time without an offset is read in the default zone",
+			sources: []string{SourceXMP},
+			xmp:     "2023-07-14T09:30:15",
+			want:    time.Date(2023, 7, 14, 9, 30, 15, 0, tokyo),
+			source:  SourceXMP,
+		},
+		{
+			name:    "modification time in the default zone",
+			sources: []string{SourceXMP, SourceModTime},
+			modTime: time.Date(2023, 7, 14, 7, 30, 15, 0, time.UTC),
+			want:    time.Date(2023, 7, 14, 16, 30, 15, 0, tokyo),
+			source:  SourceModTime,
+		},
+		{
+			name:    "no source has a time",
+			sources: []string{SourceExif, SourceXMP, SourceFileName},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := tt.file
+			if file == "" {
+				file = "IMG_0001.CR3"
+			}
+			path := filepath.Join(dir, file)
+			if err := os.WriteFile(path, []byte("photo"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.xmp != "" {
+				if err := os.WriteFile(filepath.Join(dir, "IMG_0001.xmp"), []byte(fmt.Sprintf(sidecar, tt.xmp)), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !tt.modTime.IsZero() {
+				if err := os.Chtimes(path, tt.modTime, tt.modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, source := NewResolver(tt.sources, tokyo).Resolve(path, tt.embedded)
+			if source != tt.source {
+				t.Errorf("Resolve() source = %q, want %q", source, tt.source)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+			_, gotOffset := got.Zone()
+			if _, wantOffset := tt.want.Zone(); !tt.want.IsZero() && gotOffset != wantOffset {
+				t.Errorf("Resolve() offset = %ds, want %ds", gotOffset, wantOffset)
+			}
+		})
+	}
+}
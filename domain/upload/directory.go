@@ -0,0 +1,43 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/downing/media-manager/pkg/genutils"
+)
+
+type DirectoryUploader struct {
+	basePath string
+	files    *genutils.FileManager
+}
+
+func NewDirectoryUploader(basePath string) *DirectoryUploader {
+	return &DirectoryUploader{
+		basePath: basePath,
+		files:    genutils.NewFileManager(),
+	}
+}
+
+func (u *DirectoryUploader) IsUploaded(name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(u.basePath, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check uploaded file %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// Upload copies the file through a verified temporary file, so a partial
+// upload never appears under its final name.
+func (u *DirectoryUploader) Upload(ctx context.Context, sourcePath, name string) error {
+	destinationPath := filepath.Join(u.basePath, name)
+	if _, err := u.files.CopyFile(ctx, sourcePath, destinationPath); err != nil {
+		return fmt.Errorf("failed to upload file %s to %s: %w", sourcePath, destinationPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package upload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectoryUploaderUpload(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+	if err := os.WriteFile(source, []byte("edited image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	uploader := NewDirectoryUploader(dest)
+
+	if err := uploader.Upload(context.Background(), source, filepath.Join("2023", "IMG_0001.jpg")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dest, "2023", "IMG_0001.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "edited image" {
+		t.Errorf("content = %q, want %q", content, "edited image")
+	}
+	uploaded, err := uploader.IsUploaded(filepath.Join("2023", "IMG_0001.jpg"))
+	if err != nil || !uploaded {
+		t.Errorf("IsUploaded() = %v, %v, want true", uploaded, err)
+	}
+}
+
+func TestDirectoryUploaderCancelled(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+	if err := os.WriteFile(source, []byte("edited image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := NewDirectoryUploader(dest).Upload(ctx, source, "IMG_0001.jpg"); err == nil {
+		t.Fatal("Upload() error = nil, want the cancellation")
+	}
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("upload directory holds %d files after a cancelled upload, want none", len(entries))
+	}
+}
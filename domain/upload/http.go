@@ -0,0 +1,159 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	formFileField = "file"
+	formNameField = "name"
+
+	uploadAttempts   = 3
+	uploadRetryDelay = 2 * time.Second
+)
+
+// retryableError is an upload failure that may succeed if tried again.
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryableError) Unwrap() error {
+	return e.err
+}
+
+// HTTPUploader posts files as multipart forms to a base URL and checks for
+// earlier uploads with a HEAD request on <baseURL>/<name>.
+type HTTPUploader struct {
+	baseURL string
+	client  *http.Client
+	// attempts is how often an upload is tried, waiting retryDelay, doubled
+	// each time, in between.
+	attempts   int
+	retryDelay time.Duration
+}
+
+func NewHTTPUploader(baseURL string) *HTTPUploader {
+	return &HTTPUploader{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		client:     &http.Client{Timeout: 10 * time.Minute},
+		attempts:   uploadAttempts,
+		retryDelay: uploadRetryDelay,
+	}
+}
+
+func (u *HTTPUploader) IsUploaded(name string) (bool, error) {
+	fileURL, err := u.fileURL(name)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := u.client.Head(fileURL)
+	if err != nil {
+		return false, fmt.Errorf("failed to check uploaded file %s: %w", name, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unexpected status checking uploaded file %s: %s", name, resp.Status)
+	}
+}
+
+// Upload posts the file, trying again when the request fails or the server
+// answers 429 or 5xx. Any other status is final.
+func (u *HTTPUploader) Upload(ctx context.Context, sourcePath, name string) error {
+	delay := u.retryDelay
+	for attempt := 1; ; attempt++ {
+		err := u.post(ctx, sourcePath, name)
+		if err == nil || !errors.As(err, &retryableError{}) {
+			return err
+		}
+		if attempt >= u.attempts {
+			return fmt.Errorf("%w, gave up after %d attempts", err, attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to upload file %s: %w", sourcePath, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends the file once, failures worth another attempt are a retryableError.
+func (u *HTTPUploader) post(ctx context.Context, sourcePath, name string) error {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open source file %s: %w", sourcePath, err)
+	}
+	defer sourceFile.Close()
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeForm(form, sourceFile, name))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.baseURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to build upload request for file %s: %w", sourcePath, err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := u.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to upload file %s: %w", sourcePath, err)
+		}
+		return retryableError{fmt.Errorf("failed to upload file %s: %w", sourcePath, err)}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return retryableError{fmt.Errorf("upload of file %s failed: %s", sourcePath, resp.Status)}
+	default:
+		return fmt.Errorf("upload of file %s rejected: %s", sourcePath, resp.Status)
+	}
+}
+
+func (u *HTTPUploader) fileURL(name string) (string, error) {
+	fileURL, err := url.JoinPath(u.baseURL, strings.Split(filepath.ToSlash(name), "/")...)
+	if err != nil {
+		return "", fmt.Errorf("failed to build upload url for %s: %w", name, err)
+	}
+	return fileURL, nil
+}
+
+func writeForm(form *multipart.Writer, source io.Reader, name string) error {
+	if err := form.WriteField(formNameField, filepath.ToSlash(name)); err != nil {
+		return err
+	}
+	part, err := form.CreateFormFile(formFileField, filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, source); err != nil {
+		return err
+	}
+	return form.Close()
+}
@@ -0,0 +1,112 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// standIn is a local upload server that answers each POST with the next
+// status in statuses, repeating the last one, and keeps what it accepted.
+type standIn struct {
+	statuses []int
+	requests atomic.Int32
+	name     string
+	content  string
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := int(s.requests.Add(1))
+	status := s.statuses[min(n, len(s.statuses))-1]
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	file, _, err := r.FormFile(formFileField)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.name = r.FormValue(formNameField)
+	s.content = string(content)
+}
+
+func TestHTTPUploaderUpload(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+	if err := os.WriteFile(source, []byte("edited image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"success", []int{http.StatusOK}, false, 1},
+		{"rejected", []int{http.StatusBadRequest}, true, 1},
+		{"retried", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, false, 3},
+		{"gave up", []int{http.StatusInternalServerError}, true, uploadAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &standIn{statuses: tt.statuses}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			uploader := NewHTTPUploader(ts.URL)
+			uploader.retryDelay = 0
+			err := uploader.Upload(context.Background(), source, "2023/IMG_0001.jpg")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := server.requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			if tt.wantErr {
+				return
+			}
+			if server.name != "2023/IMG_0001.jpg" {
+				t.Errorf("name = %q, want %q", server.name, "2023/IMG_0001.jpg")
+			}
+			if server.content != "edited image" {
+				t.Errorf("content = %q, want %q", server.content, "edited image")
+			}
+		})
+	}
+}
+
+func TestHTTPUploaderIsUploaded(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method = %s, want HEAD", r.Method)
+		}
+		if r.URL.Path != "/2023/IMG_0001.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	uploader := NewHTTPUploader(ts.URL)
+	for name, want := range map[string]bool{"2023/IMG_0001.jpg": true, "2023/IMG_0002.jpg": false} {
+		got, err := uploader.IsUploaded(name)
+		if err != nil {
+			t.Fatalf("IsUploaded(%q) error = %v", name, err)
+		}
+		if got != want {
+			t.Errorf("IsUploaded(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Uploader sends a local file to an upload destination under the given name.
+// Upload stops when ctx is cancelled.
+type Uploader interface {
+	IsUploaded(name string) (bool, error)
+	Upload(ctx context.Context, sourcePath, name string) error
+}
+
+// NewUploader returns the uploader for the destination, an http(s) URL selects
+// the multipart uploader and anything else is treated as a local directory.
+func NewUploader(destination string) (Uploader, error) {
+	switch {
+	case destination == "":
+		return nil, fmt.Errorf("no upload destination configured")
+	case strings.HasPrefix(destination, "http://"), strings.HasPrefix(destination, "https://"):
+		return NewHTTPUploader(destination), nil
+	default:
+		return NewDirectoryUploader(destination), nil
+	}
+}
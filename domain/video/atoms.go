@@ -0,0 +1,279 @@
+package video
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	atomMovie     = "moov"
+	atomMovieHdr  = "mvhd"
+	atomUserData  = "udta"
+	atomMeta      = "meta"
+	atomHandler   = "hdlr"
+	atomKeys      = "keys"
+	atomItemList  = "ilst"
+	atomData      = "data"
+	atomUserModel = "\xa9mod"
+
+	// maxValueSize bounds the metadata values read into memory.
+	maxValueSize = 64 * 1024
+)
+
+var errInvalidAtom = errors.New("invalid atom")
+
+// metadata is what decode finds in the movie atoms.
+type metadata struct {
+	creationTime time.Time
+	model        string
+	keys         map[string]string
+}
+
+// atom is a box header with the offsets of its payload.
+type atom struct {
+	kind  string
+	start int64
+	end   int64
+}
+
+// decode reads the movie header and QuickTime metadata from an ISO-BMFF or QuickTime file.
+func decode(r io.ReadSeeker) (metadata, error) {
+	m := metadata{keys: map[string]string{}}
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return m, err
+	}
+
+	foundMovie := false
+	err = walkAtoms(r, 0, size, func(a atom) error {
+		if a.kind != atomMovie {
+			return nil
+		}
+		foundMovie = true
+		return walkAtoms(r, a.start, a.end, func(a atom) error {
+			switch a.kind {
+			case atomMovieHdr:
+				return m.readMovieHeader(r, a)
+			case atomUserData:
+				return m.readUserData(r, a)
+			case atomMeta:
+				return m.readMeta(r, a)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return m, err
+	}
+	if !foundMovie {
+		return m, fmt.Errorf("no %s atom found", atomMovie)
+	}
+	return m, nil
+}
+
+// walkAtoms calls fn for each atom between start and end.
+func walkAtoms(r io.ReadSeeker, start, end int64, fn func(a atom) error) error {
+	pos := start
+	for pos+8 <= end {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			var largeSize [8]byte
+			if _, err := io.ReadFull(r, largeSize[:]); err != nil {
+				return fmt.Errorf("%w: %q at offset %d: %w", errInvalidAtom, header[4:], pos, err)
+			}
+			size = int64(binary.BigEndian.Uint64(largeSize[:]))
+			headerSize = 16
+		}
+		// Compare against the space left so a huge 64-bit size cannot overflow.
+		if size < headerSize || size > end-pos {
+			return fmt.Errorf("%w: %q at offset %d", errInvalidAtom, header[4:], pos)
+		}
+
+		if err := fn(atom{kind: string(header[4:]), start: pos + headerSize, end: pos + size}); err != nil {
+			return err
+		}
+		pos += size
+	}
+	return nil
+}
+
+func (m *metadata) readMovieHeader(r io.ReadSeeker, a atom) error {
+	payload, err := readPayload(r, a)
+	if err != nil {
+		return err
+	}
+
+	var seconds uint64
+	switch {
+	case len(payload) > 0 && payload[0] == 1:
+		if len(payload) < 12 {
+			return fmt.Errorf("%w: short %s", errInvalidAtom, atomMovieHdr)
+		}
+		seconds = binary.BigEndian.Uint64(payload[4:12])
+	case len(payload) >= 8:
+		seconds = uint64(binary.BigEndian.Uint32(payload[4:8]))
+	default:
+		return fmt.Errorf("%w: short %s", errInvalidAtom, atomMovieHdr)
+	}
+	// A version 1 time past what a Duration holds is garbage, leave it unset.
+	if seconds > 0 && seconds <= uint64(math.MaxInt64/time.Second) {
+		m.creationTime = quickTimeEpoch.Add(time.Duration(seconds) * time.Second)
+	}
+	return nil
+}
+
+func (m *metadata) readUserData(r io.ReadSeeker, a atom) error {
+	return walkAtoms(r, a.start, a.end, func(a atom) error {
+		switch a.kind {
+		case atomUserModel:
+			payload, err := readPayload(r, a)
+			if err != nil {
+				return err
+			}
+			m.model = quickTimeString(payload)
+		case atomMeta:
+			return m.readMeta(r, a)
+		}
+		return nil
+	})
+}
+
+// readMeta reads a meta atom, which is a full box in ISO files and a plain
+// container in QuickTime files, into keys and the model.
+func (m *metadata) readMeta(r io.ReadSeeker, a atom) error {
+	if a.end-a.start < 8 {
+		return nil
+	}
+	if _, err := r.Seek(a.start, io.SeekStart); err != nil {
+		return err
+	}
+	var peek [8]byte
+	if _, err := io.ReadFull(r, peek[:]); err != nil {
+		return err
+	}
+	start := a.start
+	if string(peek[4:]) != atomHandler {
+		start += 4
+	}
+
+	var keys []string
+	var items []atom
+	err := walkAtoms(r, start, a.end, func(a atom) error {
+		switch a.kind {
+		case atomKeys:
+			payload, err := readPayload(r, a)
+			if err != nil {
+				return err
+			}
+			keys = parseKeys(payload)
+		case atomItemList:
+			return walkAtoms(r, a.start, a.end, func(item atom) error {
+				items = append(items, item)
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		value, err := readItemValue(r, item)
+		if err != nil {
+			return err
+		}
+		if item.kind == atomUserModel {
+			m.model = value
+			continue
+		}
+		index := int(binary.BigEndian.Uint32([]byte(item.kind)))
+		if index >= 1 && index <= len(keys) {
+			m.keys[keys[index-1]] = value
+		}
+	}
+	return nil
+}
+
+// parseKeys returns the key names of a keys atom, item i in the ilst refers to key i-1.
+func parseKeys(payload []byte) []string {
+	if len(payload) < 8 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint32(payload[4:8]))
+	keys := []string{}
+	pos := 8
+	for i := 0; i < count && pos+8 <= len(payload); i++ {
+		size := int(binary.BigEndian.Uint32(payload[pos : pos+4]))
+		if size < 8 || pos+size > len(payload) {
+			break
+		}
+		keys = append(keys, string(payload[pos+8:pos+size]))
+		pos += size
+	}
+	return keys
+}
+
+// readItemValue returns the value of the data atom in an ilst item.
+func readItemValue(r io.ReadSeeker, item atom) (string, error) {
+	var value string
+	err := walkAtoms(r, item.start, item.end, func(a atom) error {
+		if a.kind != atomData {
+			return nil
+		}
+		payload, err := readPayload(r, a)
+		if err != nil {
+			return err
+		}
+		if len(payload) >= 8 {
+			value = string(payload[8:])
+		}
+		return nil
+	})
+	return value, err
+}
+
+// quickTimeString decodes a QuickTime user data text atom, a 16-bit length and
+// language followed by the text.
+func quickTimeString(payload []byte) string {
+	if len(payload) < 4 {
+		return ""
+	}
+	length := int(binary.BigEndian.Uint16(payload[:2]))
+	if 4+length > len(payload) {
+		length = len(payload) - 4
+	}
+	return string(payload[4 : 4+length])
+}
+
+func readPayload(r io.ReadSeeker, a atom) ([]byte, error) {
+	size := a.end - a.start
+	if size > maxValueSize {
+		return nil, fmt.Errorf("%w: %q too large", errInvalidAtom, a.kind)
+	}
+	if _, err := r.Seek(a.start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
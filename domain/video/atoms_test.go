@@ -0,0 +1,217 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var taken = time.Date(2023, 7, 14, 7, 30, 15, 0, time.UTC)
+
+// box returns an atom with a 32-bit size.
+func box(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, kind...), body...)
+}
+
+// largeBox returns an atom with size 1 and the size in the 64-bit field after the type.
+func largeBox(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, 1)
+	out = append(out, kind...)
+	out = binary.BigEndian.AppendUint64(out, uint64(16+len(body)))
+	return append(out, body...)
+}
+
+// toEOFBox returns an atom with size 0, which runs to the end of the file.
+func toEOFBox(kind string, payload ...[]byte) []byte {
+	return append(append([]byte{0, 0, 0, 0}, kind...), bytes.Join(payload, nil)...)
+}
+
+func movieHeaderV0(t time.Time) []byte {
+	payload := []byte{0, 0, 0, 0}
+	payload = binary.BigEndian.AppendUint32(payload, uint32(t.Sub(quickTimeEpoch)/time.Second))
+	payload = binary.BigEndian.AppendUint32(payload, uint32(t.Sub(quickTimeEpoch)/time.Second))
+	return box(atomMovieHdr, payload)
+}
+
+func movieHeaderV1(t time.Time) []byte {
+	payload := []byte{1, 0, 0, 0}
+	payload = binary.BigEndian.AppendUint64(payload, uint64(t.Sub(quickTimeEpoch)/time.Second))
+	payload = binary.BigEndian.AppendUint64(payload, uint64(t.Sub(quickTimeEpoch)/time.Second))
+	return box(atomMovieHdr, payload)
+}
+
+func userModel(model string) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(len(model)))
+	payload = append(payload, 0x55, 0xc4)
+	return box(atomUserData, box(atomUserModel, append(payload, model...)))
+}
+
+// quickTimeMeta returns a QuickTime meta atom with a keys atom and an item list.
+func quickTimeMeta(values map[string]string) []byte {
+	keys := []byte{0, 0, 0, 0}
+	keys = binary.BigEndian.AppendUint32(keys, uint32(len(values)))
+	items := [][]byte{}
+	index := uint32(1)
+	for _, key := range []string{keyModel, keyCreationDate} {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		keys = append(keys, box("mdta", []byte(key))...)
+		data := box(atomData, []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(value))
+		items = append(items, box(string(binary.BigEndian.AppendUint32(nil, index)), data))
+		index++
+	}
+	return box(atomMeta, box(atomHandler, make([]byte, 25)), box(atomKeys, keys), box(atomItemList, items...))
+}
+
+func ftyp() []byte {
+	return box("ftyp", []byte("qt  \x00\x00\x00\x00qt  "))
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    []byte
+		created time.Time
+		model   string
+		keys    map[string]string
+	}{
+		{
+			name:    "mvhd version 0",
+			file:    bytes.Join([][]byte{ftyp(), box(atomMovie, movieHeaderV0(taken))}, nil),
+			created: taken,
+		},
+		{
+			name:    "mvhd version 1",
+			file:    bytes.Join([][]byte{ftyp(), box(atomMovie, movieHeaderV1(taken))}, nil),
+			created: taken,
+		},
+		{
+			name:    "64-bit sizes",
+			file:    bytes.Join([][]byte{ftyp(), largeBox("mdat", make([]byte, 32)), largeBox(atomMovie, movieHeaderV0(taken))}, nil),
+			created: taken,
+		},
+		{
+			name:    "moov to the end of the file",
+			file:    bytes.Join([][]byte{ftyp(), box("mdat", make([]byte, 32)), toEOFBox(atomMovie, movieHeaderV0(taken), userModel("Canon EOS R5"))}, nil),
+			created: taken,
+			model:   "Canon EOS R5",
+		},
+		{
+			name:    "unset creation time",
+			file:    bytes.Join([][]byte{ftyp(), box(atomMovie, movieHeaderV0(quickTimeEpoch))}, nil),
+			created: time.Time{},
+		},
+		{
+			name: "quicktime metadata keys",
+			file: bytes.Join([][]byte{ftyp(), box(atomMovie, movieHeaderV0(taken),
+				quickTimeMeta(map[string]string{keyModel: "iPhone 14 Pro", keyCreationDate: "2023-07-14T09:30:15+0200"}))}, nil),
+			created: taken,
+			keys:    map[string]string{keyModel: "iPhone 14 Pro", keyCreationDate: "2023-07-14T09:30:15+0200"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := decode(bytes.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("decode() error = %v", err)
+			}
+			if !m.creationTime.Equal(tt.created) {
+				t.Errorf("creation time = %v, want %v", m.creationTime, tt.created)
+			}
+			if m.model != tt.model {
+				t.Errorf("model = %q, want %q", m.model, tt.model)
+			}
+			for key, want := range tt.keys {
+				if got := m.keys[key]; got != want {
+					t.Errorf("key %s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	overflow := binary.BigEndian.AppendUint32(nil, 1)
+	overflow = append(overflow, atomMovie...)
+	overflow = binary.BigEndian.AppendUint64(overflow, 1<<63-8)
+
+	// Every case but the first two is a malformed atom.
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"empty", nil},
+		{"no moov", ftyp()},
+		{"size past the end", append(binary.BigEndian.AppendUint32(nil, 4096), []byte(atomMovie+"short")...)},
+		{"size smaller than the header", append(binary.BigEndian.AppendUint32(nil, 4), []byte(atomMovie+"xxxx")...)},
+		{"64-bit size past the end", append(ftyp(), overflow...)},
+		{"64-bit size smaller than the header", append(binary.BigEndian.AppendUint32(ftyp(), 1), append([]byte(atomMovie), make([]byte, 8)...)...)},
+		{"64-bit size cut off", append(binary.BigEndian.AppendUint32(ftyp(), 1), []byte(atomMovie+"\x00\x00")...)},
+		{"child past its parent", box(atomMovie, binary.BigEndian.AppendUint32(nil, 64), []byte(atomMovieHdr), make([]byte, 16))},
+		{"short mvhd", box(atomMovie, box(atomMovieHdr, []byte{0, 0, 0}))},
+		{"short mvhd version 1", box(atomMovie, box(atomMovieHdr, []byte{1, 0, 0, 0, 0, 0, 0, 0}))},
+		{"oversized value", box(atomMovie, box(atomMovieHdr, make([]byte, maxValueSize+1)))},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decode(bytes.NewReader(tt.file))
+			if err == nil {
+				t.Fatal("decode() error = nil, want an error")
+			}
+			if i >= 2 && !errors.Is(err, errInvalidAtom) {
+				t.Errorf("decode() error = %v, want %v", err, errInvalidAtom)
+			}
+		})
+	}
+}
+
+// TestDecodeTruncated cuts a valid file at every length, none may panic or
+// read past the end.
+func TestDecodeTruncated(t *testing.T) {
+	file := bytes.Join([][]byte{ftyp(), largeBox("mdat", make([]byte, 16)), box(atomMovie, movieHeaderV1(taken), userModel("Canon EOS R5"),
+		quickTimeMeta(map[string]string{keyModel: "iPhone 14 Pro", keyCreationDate: "2023-07-14T09:30:15+0200"}))}, nil)
+	for n := range len(file) {
+		r := &boundedReader{Reader: bytes.NewReader(file[:n]), size: int64(n)}
+		_, err := decode(r)
+		if err == nil && !strings.Contains(string(file[:n]), atomMovie) {
+			t.Errorf("decode() of %d bytes without a moov atom succeeded", n)
+		}
+		if r.pastEnd {
+			t.Errorf("decode() of %d bytes read past the end", n)
+		}
+	}
+}
+
+// boundedReader records reads starting past the end of the data.
+type boundedReader struct {
+	*bytes.Reader
+	size    int64
+	pastEnd bool
+}
+
+func (r *boundedReader) Read(p []byte) (int, error) {
+	if pos, _ := r.Seek(0, io.SeekCurrent); pos > r.size {
+		r.pastEnd = true
+	}
+	return r.Reader.Read(p)
+}
+
+func TestDecodeIgnoresOutOfRangeTime(t *testing.T) {
+	payload := binary.BigEndian.AppendUint64([]byte{1, 0, 0, 0}, 1<<63)
+	m, err := decode(bytes.NewReader(box(atomMovie, box(atomMovieHdr, payload, make([]byte, 8)))))
+	if err != nil {
+		t.Fatalf("decode() error = %v", err)
+	}
+	if !m.creationTime.IsZero() {
+		t.Errorf("creation time = %v, want unset", m.creationTime)
+	}
+}
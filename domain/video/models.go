@@ -0,0 +1,27 @@
+package video
+
+import "time"
+
+type VideoData struct {
+	fileName    string
+	filePath    string
+	cameraModel string
+	timestamp   time.Time
+	createDate  time.Time
+	zoneSource  string
+}
+
+var videoFileTypes = []string{"mp4", "mov", "m4v"}
+
+// QuickTime stores times as seconds since 1904-01-01 UTC.
+var quickTimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	ZoneCreationDate = "creation_date"
+	ZoneMovieHeader  = "movie_header"
+)
+
+const (
+	keyModel        = "com.apple.quicktime.model"
+	keyCreationDate = "com.apple.quicktime.creationdate"
+)
@@ -0,0 +1,104 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func GetVideo(_ *zap.Logger, path string) (VideoData, error) {
+	var v VideoData
+	f, err := os.Open(path)
+	if err != nil {
+		return v, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	m, err := decode(f)
+	if err != nil {
+		return v, fmt.Errorf("failed to decode video: %w", err)
+	}
+
+	sepPath := strings.Split(path, "/")
+	return toVideoData(m, sepPath[len(sepPath)-1], path), nil
+}
+
+func toVideoData(m metadata, name, path string) VideoData {
+	v := VideoData{
+		fileName:    name,
+		filePath:    path,
+		cameraModel: m.model,
+		timestamp:   m.creationTime,
+		createDate:  m.creationTime,
+	}
+	if !m.creationTime.IsZero() {
+		v.zoneSource = ZoneMovieHeader
+	}
+	if m.keys[keyModel] != "" {
+		v.cameraModel = m.keys[keyModel]
+	}
+	if created, zoned, err := parseCreationDate(m.keys[keyCreationDate]); err == nil {
+		v.timestamp = created
+		v.zoneSource = ""
+		if zoned {
+			v.zoneSource = ZoneCreationDate
+		}
+	}
+	return v
+}
+
+// parseCreationDate parses the ISO 8601 creation date QuickTime writes with
+// the local offset of the device, and reports whether it had the offset.
+func parseCreationDate(value string) (time.Time, bool, error) {
+	for _, layout := range []string{"2006-01-02T15:04:05-0700", time.RFC3339} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, true, nil
+		}
+	}
+	t, err := time.Parse("2006-01-02T15:04:05", value)
+	if err == nil {
+		return t, false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("unknown creation date format: %s", value)
+}
+
+func GetVideoTypes() []string {
+	return videoFileTypes
+}
+
+func (v VideoData) GetFileName() string {
+	return v.fileName
+}
+
+func (v VideoData) GetFilePath() string {
+	return v.filePath
+}
+
+func (v VideoData) GetCameraModel() string {
+	return strings.ToLower(v.cameraModel)
+}
+
+// GetCameraSerial returns "", the serial number of the device is not read from videos.
+func (v VideoData) GetCameraSerial() string {
+	return ""
+}
+
+// GetTimeZoneSource returns ZoneCreationDate when the timestamp is in the
+// zone the video was taken in, ZoneMovieHeader when it is a UTC time with no
+// record of that zone, or "" when it is a wall clock time in an unknown zone.
+func (v VideoData) GetTimeZoneSource() string {
+	return v.zoneSource
+}
+
+func (v VideoData) GetTimestamp() time.Time {
+	return v.timestamp
+}
+
+// GetCreateDate returns the creation time in the movie header, written in UTC by most devices.
+func (v VideoData) GetCreateDate() time.Time {
+	return v.createDate
+}
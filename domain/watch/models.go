@@ -0,0 +1,27 @@
+package watch
+
+import "time"
+
+// VolumeFileName is the identifier file written in the watched path, which
+// is on the card, so the card is recognised when it is inserted again.
+const VolumeFileName = ".media-manager-volume"
+
+// Options are what to watch and how often.
+type Options struct {
+	// Path is the source that appears when a card is mounted.
+	Path string
+	// Interval is how often Path is checked.
+	Interval time.Duration
+	// Settle is how long Path must stay unchanged before the operations run,
+	// so a card that is still mounting or being written to is left alone.
+	Settle time.Duration
+}
+
+// state is what the last check saw of the watched path.
+type state struct {
+	present   bool
+	signature string
+	// pending means the path changed since the operations last ran.
+	pending   bool
+	changedAt time.Time
+}
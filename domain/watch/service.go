@@ -0,0 +1,207 @@
+package watch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"go.uber.org/zap"
+)
+
+// Session is the library opened for one import. It holds the library until
+// Close, so nothing is held while the watch is idle.
+type Session interface {
+	Volume(id string) (catalog.Volume, bool, error)
+	PutVolume(volume catalog.Volume) error
+	Run(ctx context.Context) error
+	Close()
+}
+
+type Service struct {
+	logger  *zap.Logger
+	options Options
+}
+
+func NewService(logger *zap.Logger, options Options) *Service {
+	return &Service{
+		logger:  logger,
+		options: options,
+	}
+}
+
+// Run polls the watched path until ctx is cancelled and opens a session to
+// run the operations each time it appears or changes and then settles. A
+// volume whose files are as they were after its last import is not imported
+// again. A session that cannot be opened, because another run holds the
+// library, is tried again once the path has settled again. A failed run is
+// logged and watching carries on, only an interrupted run is returned.
+func (s *Service) Run(ctx context.Context, open func() (Session, error)) error {
+	s.logger.Info("Watching for the raw path", zap.String("path", s.options.Path),
+		zap.Duration("interval", s.options.Interval), zap.Duration("settle", s.options.Settle))
+
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+
+	var st state
+	for {
+		if err := s.check(ctx, &st, open); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Stopped watching for the raw path")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check compares the watched path with the last check and runs the
+// operations once a change has settled.
+func (s *Service) check(ctx context.Context, st *state, open func() (Session, error)) error {
+	signature, present, err := s.snapshot()
+	if err != nil {
+		// the card may be going away mid-walk, wait for it to settle
+		s.logger.Debug("Failed to read raw path", zap.String("path", s.options.Path), zap.Error(err))
+		st.changedAt = time.Now()
+		return nil
+	}
+
+	switch {
+	case !present:
+		if st.present {
+			s.logger.Info("Raw path went away", zap.String("path", s.options.Path))
+		}
+		*st = state{}
+		return nil
+	case !st.present:
+		s.logger.Info("Raw path appeared, waiting for it to settle", zap.String("path", s.options.Path))
+		st.pending, st.changedAt = true, time.Now()
+	case signature != st.signature:
+		s.logger.Debug("Raw path changed, waiting for it to settle", zap.String("path", s.options.Path), zap.String("signature", signature))
+		st.pending, st.changedAt = true, time.Now()
+	}
+	st.present, st.signature = true, signature
+
+	if !st.pending || time.Since(st.changedAt) < s.options.Settle {
+		return nil
+	}
+	session, err := open()
+	if err != nil {
+		s.logger.Warn("Failed to open the library, trying again once the raw path settles", zap.Error(err))
+		st.changedAt = time.Now()
+		return nil
+	}
+	defer session.Close()
+
+	st.pending = false
+	st.signature, err = s.importVolume(ctx, signature, session)
+	return err
+}
+
+// importVolume runs the operations unless the volume was already imported as
+// it is, and records it once they succeed. It returns the signature of the
+// path after the run, as moving files off the card changes it.
+func (s *Service) importVolume(ctx context.Context, signature string, session Session) (string, error) {
+	id := s.volumeID()
+	volume, found, err := session.Volume(id)
+	if err != nil {
+		return signature, err
+	}
+	if found && volume.Signature == signature {
+		s.logger.Info("Volume already imported, waiting for new files", zap.String("volume_id", id), zap.Time("imported_at", volume.ImportedAt))
+		return signature, nil
+	}
+
+	s.logger.Info("Raw path settled, running operations", zap.String("path", s.options.Path), zap.String("volume_id", id))
+	err = session.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		return signature, err
+	}
+	if err != nil {
+		s.logger.Error("Operations failed, the volume is tried again when it changes or is inserted again", zap.String("volume_id", id), zap.Error(err))
+		return signature, nil
+	}
+
+	after, present, err := s.snapshot()
+	if err != nil || !present {
+		s.logger.Warn("Raw path went away before the import was recorded", zap.String("volume_id", id), zap.Error(err))
+		return signature, nil
+	}
+	err = session.PutVolume(catalog.Volume{ID: id, Path: s.options.Path, Signature: after, ImportedAt: time.Now()})
+	if err != nil {
+		return after, err
+	}
+	s.logger.Info("Volume imported, waiting for the next card", zap.String("volume_id", id))
+	return after, nil
+}
+
+// snapshot describes the files in the watched path by their count, total size
+// and newest modification time, which change whenever files are added,
+// removed or written. It reports whether the path exists.
+func (s *Service) snapshot() (string, bool, error) {
+	info, err := os.Stat(s.options.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if !info.IsDir() {
+		return "", false, nil
+	}
+
+	var count int
+	var size int64
+	var newest time.Time
+	err = filepath.WalkDir(s.options.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() == VolumeFileName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		count++
+		size += info.Size()
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to walk %s: %w", s.options.Path, err)
+	}
+	return fmt.Sprintf("%d files, %d bytes, newest %s", count, size, newest.UTC().Format(time.RFC3339Nano)), true, nil
+}
+
+// volumeID reads the identifier file in the watched path, writing a new one
+// the first time the volume is seen. A read-only volume is identified by its
+// path.
+func (s *Service) volumeID() string {
+	path := filepath.Join(s.options.Path, VolumeFileName)
+	data, err := os.ReadFile(path)
+	if err == nil && strings.TrimSpace(string(data)) != "" {
+		return strings.TrimSpace(string(data))
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	encoded := hex.EncodeToString(id)
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0644); err != nil {
+		s.logger.Debug("Failed to write volume identifier, identifying the volume by its path", zap.String("path", path), zap.Error(err))
+		return "path:" + s.options.Path
+	}
+	return encoded
+}
@@ -5,7 +5,9 @@ go 1.25.5
 require (
 	github.com/caarlos0/env/v11 v11.3.1
 	github.com/evanoberholster/imagemeta v0.3.1
+	go.etcd.io/bbolt v1.4.3
 	go.uber.org/zap v1.27.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -16,5 +18,5 @@ require (
 	github.com/rs/zerolog v1.29.0 // indirect
 	github.com/tinylib/msgp v1.1.8 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
 )
@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
+
 	"github.com/downing/media-manager/domain/sorting"
 	"go.uber.org/zap"
 )
 
-func backupEditedFiles(logger *zap.Logger, sortingService *sorting.Service) error {
+func backupEditedFiles(ctx context.Context, logger *zap.Logger, sortingService *sorting.Service) error {
 	logger.Info("Starting backup of edited files")
 
-	err := sortingService.BackupEditedFiles()
+	err := sortingService.BackupEditedFiles(ctx)
 	if err != nil {
 		return err
 	}
@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
+
 	"github.com/downing/media-manager/domain/sorting"
 	"go.uber.org/zap"
 )
 
-func backupRawFiles(logger *zap.Logger, sortingService *sorting.Service) error {
+func backupRawFiles(ctx context.Context, logger *zap.Logger, sortingService *sorting.Service) error {
 	logger.Info("Starting backup of raw files")
 
-	err := sortingService.BackupLocalRawFiles()
+	err := sortingService.BackupLocalRawFiles(ctx)
 	if err != nil {
 		return err
 	}
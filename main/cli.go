@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	exitOK             = 0
+	exitFailure        = 1
+	exitUsage          = 2
+	exitPartialFailure = 3
+	// exitInterrupted follows the shell convention for SIGINT, 128+2.
+	exitInterrupted = 130
+)
+
+// libraryMode is how a command uses the library.
+type libraryMode int
+
+const (
+	// libraryRead opens the media catalog.
+	libraryRead libraryMode = iota
+	// libraryWrite locks the library before opening the media catalog,
+	// unless the command only plans.
+	libraryWrite
+	// libraryNone leaves the library to the command.
+	libraryNone
+)
+
+// operationKeys are the env vars that enable each sorting operation.
+var operationKeys = []string{"import_raw", "backup_raw", "backup_edited", "upload_edited"}
+
+// command is one media-manager subcommand.
+type command struct {
+	name    string
+	summary string
+	// operation is the env var the command enables, empty for commands that do
+	// not run a sorting operation.
+	operation string
+	// keepOperations leaves the operations other than operation enabled as
+	// the env vars and config file set them.
+	keepOperations bool
+	library        libraryMode
+	flags          func(fs *flag.FlagSet, o *options)
+	run            func(a *app, o *options) int
+}
+
+// options are the flags shared between commands. Only flags given on the
+// command line override the env vars and config file.
+type options struct {
+	configPath string
+	restoreTo  string
+	clockPhoto string
+	clockTime  string
+	overrides  map[string]string
+}
+
+var commands = []command{
+	{
+		name:      "import",
+		library:   libraryWrite,
+		summary:   "import raw files from the card into the local raw path",
+		operation: "import_raw",
+		flags:     operationFlags,
+		run:       runOperationCommand,
+	},
+	{
+		name:      "backup raw",
+		library:   libraryWrite,
+		summary:   "back up the local raw files",
+		operation: "backup_raw",
+		flags:     operationFlags,
+		run:       runOperationCommand,
+	},
+	{
+		name:      "backup edited",
+		library:   libraryWrite,
+		summary:   "back up the local edited files",
+		operation: "backup_edited",
+		flags:     operationFlags,
+		run:       runOperationCommand,
+	},
+	{
+		name:      "upload",
+		library:   libraryWrite,
+		summary:   "upload the local edited files",
+		operation: "upload_edited",
+		flags: func(fs *flag.FlagSet, o *options) {
+			operationFlags(fs, o)
+			fs.Func("upload-dest", "directory or http(s) URL to upload to (env upload_dest)", o.set("upload_dest"))
+		},
+		run: runOperationCommand,
+	},
+	{
+		name:           "watch",
+		summary:        "import, and run the enabled backups, whenever a card is mounted at the raw path",
+		operation:      "import_raw",
+		keepOperations: true,
+		library:        libraryNone,
+		flags: func(fs *flag.FlagSet, o *options) {
+			transferFlags(fs, o)
+			fs.Func("upload-dest", "directory or http(s) URL to upload to (env upload_dest)", o.set("upload_dest"))
+			fs.Func("interval", "how often to check the raw path, such as 2s (env watch_interval)", o.set("watch_interval"))
+			fs.Func("settle", "how long the raw path must stay unchanged before importing, such as 10s (env watch_settle)", o.set("watch_settle"))
+		},
+		run: runWatch,
+	},
+	{
+		name:    "retry-failed",
+		library: libraryWrite,
+		summary: "re-attempt only the files in the failure report of the last run",
+		flags: func(fs *flag.FlagSet, o *options) {
+			transferFlags(fs, o)
+			fs.Func("upload-dest", "directory or http(s) URL to upload to (env upload_dest)", o.set("upload_dest"))
+		},
+		run: runRetryFailed,
+	},
+	{
+		name:    "status",
+		summary: "show how many files each operation would transfer",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Func("upload-dest", "directory or http(s) URL to upload to (env upload_dest)", o.set("upload_dest"))
+		},
+		run: runStatus,
+	},
+	{
+		name:    "duplicates",
+		summary: "list every set of byte-identical files across the media paths",
+		run:     runDuplicates,
+	},
+	{
+		name:    "verify",
+		summary: "re-hash catalogued copies and report missing or changed files",
+		run:     runVerify,
+	},
+	{
+		name:    "clock-offset",
+		library: libraryNone,
+		summary: "work out a camera's clock offset from a photo of a clock",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.clockPhoto, "photo", "", "photo of a clock taken with the camera")
+			fs.StringVar(&o.clockTime, "time", "", "time the clock showed, \"YYYY-MM-DD HH:MM:SS\" or HH:MM:SS on the day of the photo")
+		},
+		run: runClockOffset,
+	},
+	{
+		name:    "restore",
+		library: libraryWrite,
+		summary: "copy missing local files back from their backups",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.restoreTo, "to", "", "restore under this directory instead of the original paths")
+			fs.BoolFunc("dry-run", "list the files that would be restored without copying them", o.set("dry_run"))
+		},
+		run: runRestore,
+	},
+}
+
+// runCLI runs the command in args and returns the exit code. Without a
+// command the operations enabled by the env vars are run, as before
+// subcommands existed.
+func runCLI(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runLegacy(args)
+	}
+	if args[0] == "help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+
+	cmd, rest, ok := findCommand(args)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", strings.Join(args, " "))
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	o := &options{overrides: map[string]string{}}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: media-manager %s [flags]\n\n%s\n\nFlags:\n", cmd.name, cmd.summary)
+		fs.PrintDefaults()
+	}
+	commonFlags(fs, o)
+	if cmd.flags != nil {
+		cmd.flags(fs, o)
+	}
+	if err := fs.Parse(rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return exitUsage
+	}
+
+	for _, key := range operationKeys {
+		if cmd.keepOperations && key != cmd.operation {
+			continue
+		}
+		o.overrides[key] = strconv.FormatBool(key == cmd.operation)
+	}
+
+	a, err := newApp(o.configPath, o.overrides)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return exitUsage
+	}
+	defer a.close()
+
+	if cmd.library != libraryNone {
+		if err := a.open(cmd.library); err != nil {
+			return a.openFailed(err)
+		}
+	}
+	return cmd.run(a, o)
+}
+
+// runLegacy runs the operations enabled by the import_raw, backup_raw,
+// backup_edited and upload_edited env vars.
+func runLegacy(args []string) int {
+	o := &options{overrides: map[string]string{}}
+	fs := flag.NewFlagSet("media-manager", flag.ContinueOnError)
+	fs.Usage = func() { usage(fs.Output()) }
+	fs.StringVar(&o.configPath, "config", "", "path to the config file")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	a, err := newApp(o.configPath, o.overrides)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return exitUsage
+	}
+	defer a.close()
+
+	if err := a.open(libraryWrite); err != nil {
+		return a.openFailed(err)
+	}
+	return runOperations(a)
+}
+
+// findCommand matches the longest command name at the start of args.
+func findCommand(args []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):], true
+		}
+	}
+	return command{}, nil, false
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: media-manager <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-15s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'media-manager <command> -h' for the flags of a command. Without a command")
+	fmt.Fprintln(w, "the operations enabled by the import_raw, backup_raw, backup_edited and")
+	fmt.Fprintln(w, "upload_edited env vars are run. Env vars and the config file give the defaults")
+	fmt.Fprintln(w, "for every flag.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit codes: 0 success, 1 failure, 2 usage or config error, 3 some files failed,")
+	fmt.Fprintln(w, "130 interrupted.")
+}
+
+func commonFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.configPath, "config", "", "path to the config file")
+	fs.Func("profile", "path profile to use (env path_config)", o.set("path_config"))
+	fs.Func("log-level", "debug, info, warn or error (env log_level)", o.set("log_level"))
+	fs.Func("since", "only files taken on or after this date, YYYY-MM-DD or RFC3339 (env since)", o.set("since"))
+}
+
+func operationFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolFunc("dry-run", "print the plan without changing anything (env dry_run)", o.set("dry_run"))
+	transferFlags(fs, o)
+	fs.Func("plan-format", "table or json (env plan_format)", o.set("plan_format"))
+	fs.Func("plan-output", "write the dry run plan to this file (env plan_output)", o.set("plan_output"))
+	fs.Func("execute-plan", "execute a plan saved with --plan-format json (env execute_plan)", o.set("execute_plan"))
+}
+
+// transferFlags are the flags of commands that transfer files.
+func transferFlags(fs *flag.FlagSet, o *options) {
+	fs.Func("jobs", "number of read and write workers (env read_jobs, write_jobs)", func(value string) error {
+		jobs, err := strconv.Atoi(value)
+		if err != nil || jobs < 1 {
+			return fmt.Errorf("must be a positive number")
+		}
+		o.overrides["read_jobs"] = value
+		o.overrides["write_jobs"] = value
+		return nil
+	})
+	fs.Func("file-op", "copy or move (env file_op)", o.set("file_op"))
+	fs.Func("collisions", "skip-if-identical, suffix, error or overwrite, for a different file at the destination (env collisions)", o.set("collisions"))
+	fs.Func("duplicates", "skip, hardlink or off, for files already in the destination tree (env duplicates)", o.set("duplicates"))
+	fs.Func("timestamp-sources", "comma separated order to find when a file was taken, from exif, create_date, xmp, filename and mtime (env timestamp_sources)", o.set("timestamp_sources"))
+	fs.Func("quarantine-dir", "where files with no usable timestamp go, relative to the destination (env quarantine_dir)", o.set("quarantine_dir"))
+	fs.Func("timezone", "zone of times that do not record one, a name such as Europe/Paris or an offset such as +02:00 (env timezone)", o.set("timezone"))
+	fs.Func("shoot-tz", "zone the files were taken in, date folders use its local time (env shoot_timezone)", o.set("shoot_timezone"))
+	fs.Func("failure-report", "where the files that failed are written and retried from (env failure_report)", o.set("failure_report"))
+}
+
+// set returns a flag setter that overrides the given env var.
+func (o *options) set(key string) func(string) error {
+	return func(value string) error {
+		o.overrides[key] = value
+		return nil
+	}
+}
+
+func runOperationCommand(a *app, _ *options) int {
+	return runOperations(a)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/downing/media-manager/domain/images"
+	"github.com/downing/media-manager/domain/timestamps"
+	"github.com/downing/media-manager/pkg/config"
+	"go.uber.org/zap"
+)
+
+func toOffsetRules(offsets []config.ClockOffset) timestamps.OffsetRules {
+	rules := timestamps.OffsetRules{}
+	for _, o := range offsets {
+		rules = append(rules, timestamps.OffsetRule{
+			Camera: o.Camera,
+			Serial: o.Serial,
+			Offset: o.Offset,
+			From:   o.From,
+			To:     o.To,
+		})
+	}
+	return rules
+}
+
+// runClockOffset works out a camera's clock offset from a photo of a clock,
+// comparing the time the camera recorded with the time the clock showed, and
+// prints the rule to add to the config file.
+func runClockOffset(a *app, o *options) int {
+	if o.clockPhoto == "" || o.clockTime == "" {
+		fmt.Fprintln(os.Stderr, "clock-offset needs --photo and --time")
+		return exitUsage
+	}
+
+	photo, err := images.GetPhoto(a.logger, o.clockPhoto)
+	if err != nil {
+		a.logger.Error("Failed to read reference photo", zap.String("photo", o.clockPhoto), zap.Error(err))
+		return exitFailure
+	}
+	recorded := photo.GetTimestamp()
+	if recorded.IsZero() {
+		a.logger.Error("Reference photo has no capture time", zap.String("photo", o.clockPhoto))
+		return exitFailure
+	}
+
+	actual, err := parseClockTime(o.clockTime, recorded)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	offset := timestamps.ClockOffset(recorded, actual)
+
+	camera := photo.GetCameraModel()
+	fmt.Printf("Camera:        %s\n", camera)
+	if photo.GetCameraSerial() != "" {
+		fmt.Printf("Serial:        %s\n", photo.GetCameraSerial())
+	}
+	fmt.Printf("Camera time:   %s\n", recorded.Format(time.DateTime))
+	fmt.Printf("Actual time:   %s\n", actual.Format(time.DateTime))
+	fmt.Printf("Offset:        %s\n", formatOffset(offset))
+	if offset == 0 {
+		fmt.Println("\nThe camera clock is correct, no rule needed.")
+		return exitOK
+	}
+
+	fmt.Println("\nAdd this rule to clock_offsets in the config file, with a to: date once the camera clock is fixed:")
+	fmt.Printf("  - camera: %s\n", camera)
+	if photo.GetCameraSerial() != "" {
+		fmt.Printf("    serial: %q\n", photo.GetCameraSerial())
+	}
+	fmt.Printf("    offset: %s\n", formatOffset(offset))
+	fmt.Printf("    from: %s\n", recorded.Format(time.DateOnly))
+	return exitOK
+}
+
+// parseClockTime reads the time the clock in the reference photo showed, a
+// date and time, or only a time on the day the camera recorded.
+func parseClockTime(value string, recorded time.Time) (time.Time, error) {
+	for _, layout := range []string{time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{time.TimeOnly, "15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Date(recorded.Year(), recorded.Month(), recorded.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s, use \"YYYY-MM-DD HH:MM:SS\" or HH:MM:SS", value)
+}
+
+// formatOffset writes an offset with its sign, as the config file expects.
+func formatOffset(offset time.Duration) string {
+	s := offset.String()
+	if !strings.HasPrefix(s, "-") {
+		s = "+" + s
+	}
+	return s
+}
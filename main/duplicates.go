@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runDuplicates lists every cluster of byte-identical files in the raw, local
+// and backup paths.
+func runDuplicates(a *app, _ *options) int {
+	clusters, err := a.sortingService.FindDuplicates(a.ctx)
+	if err != nil {
+		return a.stopped("Failed to find duplicates", err)
+	}
+
+	var wasted int64
+	for _, cluster := range clusters {
+		fmt.Fprintf(os.Stdout, "%s  %d bytes  %d copies\n", cluster.Checksum[:12], cluster.Size, len(cluster.Paths))
+		for _, path := range cluster.Paths {
+			fmt.Fprintf(os.Stdout, "  %s\n", path)
+		}
+		wasted += cluster.Size * int64(len(cluster.Paths)-1)
+	}
+	fmt.Fprintf(os.Stdout, "%d duplicate sets, %d bytes in extra copies\n", len(clusters), wasted)
+	return exitOK
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/downing/media-manager/domain/sorting"
+	"go.uber.org/zap"
+)
+
+// saveFailureReport writes the files that failed in this run to the failure
+// report, or removes the report of an earlier run when nothing failed.
+func saveFailureReport(a *app) {
+	path := a.cfg.FailureReport()
+	failures := a.sortingService.Failures()
+	if len(failures) == 0 {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			a.logger.Warn("Failed to remove old failure report", zap.String("failure_report", path), zap.Error(err))
+		}
+		return
+	}
+
+	err := writeFailureReport(path, sorting.FailureReport{CreatedAt: time.Now(), Failures: failures})
+	if err != nil {
+		a.logger.Error("Failed to write failure report", zap.String("failure_report", path), zap.Error(err))
+		return
+	}
+	a.logger.Error("Some files failed, run retry-failed to try them again", zap.Int("file_count", len(failures)), zap.String("failure_report", path))
+}
+
+func writeFailureReport(path string, report sorting.FailureReport) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create failure report: %w", err)
+	}
+	defer file.Close()
+
+	if err := sorting.WriteFailureReport(file, report); err != nil {
+		return fmt.Errorf("failed to write failure report: %w", err)
+	}
+	return file.Close()
+}
+
+// runRetryFailed re-attempts the files in the failure report, each in the
+// operation it failed in, and replaces the report with what still fails.
+func runRetryFailed(a *app, _ *options) int {
+	path := a.cfg.FailureReport()
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No failure report, nothing to retry")
+		return exitOK
+	}
+	if err != nil {
+		a.logger.Error("Failed to open failure report", zap.String("failure_report", path), zap.Error(err))
+		return exitFailure
+	}
+	report, err := sorting.ReadFailureReport(file)
+	file.Close()
+	if err != nil {
+		a.logger.Error("Failed to read failure report", zap.String("failure_report", path), zap.Error(err))
+		return exitFailure
+	}
+
+	startTime := time.Now()
+	a.logger.Info("Starting retry of failed files", zap.String("failure_report", path), zap.Int("file_count", len(report.Failures)))
+	defer saveFailureReport(a)
+
+	err = a.sortingService.RetryFailures(a.ctx, report.Failures)
+	if err != nil {
+		return a.stopped("Failed to retry failed files", err)
+	}
+
+	a.stats.FinalStats(a.logger)
+	a.logger.Info("Retry of failed files completed in " + time.Since(startTime).String())
+	return runExitCode(a.stats)
+}
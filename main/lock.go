@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/pkg/filelock"
+	"github.com/downing/media-manager/pkg/genutils"
+	"go.uber.org/zap"
+)
+
+// lockLibraries locks the local raw and backup paths so two runs never copy
+// into them at once, then removes the temporary files earlier runs left
+// behind, which is only safe while no other run is writing. Paths that do not
+// exist yet are left for ValidatePaths to report.
+func (a *app) lockLibraries() error {
+	locked := map[string]bool{}
+	for _, path := range []string{a.cfg.LocalRawPath(), a.cfg.BackupPath()} {
+		if path == "" || locked[filepath.Clean(path)] {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		lock, err := filelock.Acquire(path)
+		if err != nil {
+			return err
+		}
+		if stale, ok := lock.Stale(); ok {
+			a.logger.Warn("Took over the lock of a run that did not finish", zap.String("path", path),
+				zap.Int("pid", stale.PID), zap.String("host", stale.Host), zap.Time("started_at", stale.StartedAt))
+		}
+		a.logger.Debug("Locked library", zap.String("lock_file", lock.Path()))
+		a.locks = append(a.locks, lock)
+		locked[filepath.Clean(path)] = true
+	}
+
+	removeStaleTempFiles(a.logger, genutils.NewFileManager(), a.cfg)
+	return nil
+}
+
+func (a *app) unlockLibraries() {
+	for _, lock := range a.locks {
+		if err := lock.Release(); err != nil {
+			a.logger.Error("Failed to release library lock", zap.Error(err))
+		}
+	}
+	a.locks = nil
+}
+
+// openFailed logs why the library could not be opened and returns the exit
+// code. When another run has the catalog open, the run holding the library
+// locks is named, as it is most likely the one.
+func (a *app) openFailed(err error) int {
+	var held *filelock.HeldError
+	switch {
+	case errors.As(err, &held):
+		a.logger.Error("Another run is using the library, try again once it finishes", zap.Error(err))
+	case errors.Is(err, catalog.ErrInUse):
+		fields := []zap.Field{zap.String("catalog_path", a.cfg.CatalogPath())}
+		for _, path := range []string{a.cfg.LocalRawPath(), a.cfg.BackupPath()} {
+			if holder, ok := filelock.Holding(path); ok {
+				fields = append(fields, zap.String("path", path), zap.Stringer("held_by", holder))
+				break
+			}
+		}
+		a.logger.Error("Another run has the media catalog open, try again once it finishes", fields...)
+	default:
+		a.logger.Error("Failed to open library", zap.Error(err))
+	}
+	return exitFailure
+}
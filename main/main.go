@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"time"
 
+	"github.com/downing/media-manager/domain/catalog"
 	"github.com/downing/media-manager/domain/files"
+	"github.com/downing/media-manager/domain/filters"
+	"github.com/downing/media-manager/domain/images"
 	"github.com/downing/media-manager/domain/sorting"
+	"github.com/downing/media-manager/domain/upload"
+	"github.com/downing/media-manager/domain/video"
 	"github.com/downing/media-manager/pkg/config"
+	"github.com/downing/media-manager/pkg/filelock"
 	"github.com/downing/media-manager/pkg/genutils"
 	"github.com/downing/media-manager/pkg/logging"
 	runtimestats "github.com/downing/media-manager/pkg/runtime_stats"
@@ -14,66 +23,169 @@ import (
 )
 
 func main() {
-	startTime := time.Now()
-	var importDuration, backupRawDuration, backupEditedDuration, uploadEditedDuration time.Duration
-	cfg, err := config.GetConfig()
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// app holds everything a command needs once the config has been loaded.
+// ctx is cancelled when the process is interrupted.
+type app struct {
+	ctx            context.Context
+	stop           func()
+	locks          []*filelock.Lock
+	cfg            config.Config
+	logger         *zap.Logger
+	stats          *runtimestats.Stats
+	catalog        *catalog.Service
+	sortingService *sorting.Service
+}
+
+// newApp loads the config and sets up logging and interrupt handling. The
+// library is opened separately, by open.
+func newApp(configPath string, overrides map[string]string) (*app, error) {
+	cfg, err := config.GetConfig(configPath, overrides)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	logger := logging.NewLogger(cfg.LogLevel())
-	defer logger.Sync()
 
 	cfg.LogConfig(logger)
 
 	logger.Info("Media Manager started")
 
-	stats := runtimestats.NewStats()
+	ctx, stop := notifyInterrupt(logger)
+	return &app{
+		ctx:    ctx,
+		stop:   stop,
+		cfg:    cfg,
+		logger: logger,
+		stats:  runtimestats.NewStats(),
+	}, nil
+}
+
+// open opens the media catalog and sets up the sorting service. A command
+// that transfers files locks the library first, so a run that finds it in
+// use says which run holds it instead of waiting on the catalog. Commands
+// that only read, and runs that only plan, open the catalog read only so they
+// work while another run has it open.
+func (a *app) open(mode libraryMode) error {
+	planOnly := mode == libraryWrite && a.cfg.ExecutePlan() == "" && a.cfg.DryRun()
+	if mode == libraryWrite && !planOnly {
+		if err := a.lockLibraries(); err != nil {
+			return err
+		}
+	}
+
+	openCatalog := catalog.Open
+	if planOnly || mode == libraryRead {
+		openCatalog = catalog.OpenReadOnly
+	}
+	mediaCatalog, err := openCatalog(a.cfg.CatalogPath())
+	if err != nil {
+		return fmt.Errorf("failed to open media catalog: %w", err)
+	}
+	a.catalog = mediaCatalog
+
+	var uploader upload.Uploader
+	if a.cfg.UploadEdited() || a.cfg.UploadDestination() != "" {
+		uploader, err = upload.NewUploader(a.cfg.UploadDestination())
+		if err != nil {
+			return fmt.Errorf("failed to create uploader: %w", err)
+		}
+	}
 
 	fileManager := files.NewService(genutils.NewFileManager())
-	sortingService := sorting.NewService(
-		logger,
+	a.sortingService = sorting.NewService(
+		a.logger,
 		fileManager,
-		toSortingCtiteria(cfg),
-		stats,
+		toSortingCtiteria(a.cfg),
+		mediaCatalog,
+		uploader,
+		a.stats,
 	)
+	return nil
+}
+
+// close releases the catalog before the locks, so a run waiting for the
+// library can open the catalog as soon as it gets them.
+func (a *app) close() {
+	a.stop()
+	if a.catalog != nil {
+		if err := a.catalog.Close(); err != nil {
+			a.logger.Error("Failed to close media catalog", zap.Error(err))
+		}
+	}
+	a.unlockLibraries()
+	a.logger.Sync()
+}
+
+// runOperations runs the import, backup and upload operations enabled in the
+// config, or plans them in dry run mode, and returns the exit code.
+func runOperations(a *app) int {
+	startTime := time.Now()
+	var importDuration, backupRawDuration, backupEditedDuration, uploadEditedDuration time.Duration
+	cfg, logger, stats, sortingService := a.cfg, a.logger, a.stats, a.sortingService
+
+	err := cfg.ValidatePaths()
+	if err != nil {
+		logger.Error("Invalid paths in config", zap.Error(err))
+		return exitUsage
+	}
+
+	if cfg.ExecutePlan() != "" || !cfg.DryRun() {
+		defer saveFailureReport(a)
+	}
+
+	if cfg.ExecutePlan() != "" {
+		err := executePlan(a.ctx, logger, cfg.ExecutePlan(), sortingService)
+		if err != nil {
+			return a.stopped("Failed to execute plan", err)
+		}
+		stats.FinalStats(logger)
+		logger.Info("Media Manager completed in " + time.Since(startTime).String())
+		return runExitCode(stats)
+	}
+
+	if cfg.DryRun() {
+		err := planOperations(a.ctx, logger, cfg, sortingService)
+		if err != nil {
+			return a.stopped("Failed to plan operations", err)
+		}
+		return exitOK
+	}
 
 	if cfg.ImportRaw() {
 		importStart := time.Now()
-		err := importRawFiles(logger, sortingService)
+		err := importRawFiles(a.ctx, logger, sortingService)
 		if err != nil {
-			logger.Error("Failed to import raw files", zap.Error(err))
-			return
+			return a.stopped("Failed to import raw files", err)
 		}
 		importDuration = time.Since(importStart)
 	}
 
 	if cfg.BackupRaw() {
 		backupRawStart := time.Now()
-		err := backupRawFiles(logger, sortingService)
+		err := backupRawFiles(a.ctx, logger, sortingService)
 		if err != nil {
-			logger.Error("Failed to backup raw files", zap.Error(err))
-			return
+			return a.stopped("Failed to backup raw files", err)
 		}
 		backupRawDuration = time.Since(backupRawStart)
 	}
 
 	if cfg.BackupEdited() {
 		backupEditedStart := time.Now()
-		err := backupEditedFiles(logger, sortingService)
+		err := backupEditedFiles(a.ctx, logger, sortingService)
 		if err != nil {
-			logger.Error("Failed to backup edited files", zap.Error(err))
-			return
+			return a.stopped("Failed to backup edited files", err)
 		}
 		backupEditedDuration = time.Since(backupEditedStart)
 	}
 
 	if cfg.UploadEdited() {
 		uploadEditedStart := time.Now()
-		err := uploadEditedFiles(logger, sortingService)
+		err := uploadEditedFiles(a.ctx, logger, sortingService)
 		if err != nil {
-			logger.Error("Failed to upload edited files", zap.Error(err))
-			return
+			return a.stopped("Failed to upload edited files", err)
 		}
 		uploadEditedDuration = time.Since(uploadEditedStart)
 	}
@@ -93,16 +205,80 @@ func main() {
 		logMsg += ", Upload Edited Duration: " + uploadEditedDuration.String()
 	}
 	logger.Info(logMsg)
+	return runExitCode(stats)
+}
+
+// runExitCode reports a partial failure when some files could not be processed.
+func runExitCode(stats *runtimestats.Stats) int {
+	if stats.Counter(runtimestats.ChecksumErrors) > 0 || stats.Counter(runtimestats.FilesFailed) > 0 {
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+func removeStaleTempFiles(logger *zap.Logger, fileManager *genutils.FileManager, cfg config.Config) {
+	for _, path := range []string{cfg.LocalRawPath(), cfg.LocalEditedPath(), cfg.BackupPath()} {
+		removed, err := fileManager.RemoveStaleTempFiles(path)
+		if err != nil {
+			logger.Warn("Failed to remove stale temporary files", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		if removed > 0 {
+			logger.Info("Removed stale temporary files", zap.String("path", path), zap.Int("file_count", removed))
+		}
+	}
+}
+
+// toFilters builds the filter of each operation from its configured rules.
+func toFilters(rules map[string][]config.FilterRule) map[string]*filters.Filter {
+	byOperation := map[string]*filters.Filter{}
+	for operation, configured := range rules {
+		operationRules := []filters.Rule{}
+		for _, r := range configured {
+			operationRules = append(operationRules, filters.Rule{
+				Action:     r.Action,
+				Path:       r.Path,
+				Extensions: r.Extensions,
+				MinSize:    r.MinSize,
+				MaxSize:    r.MaxSize,
+				Camera:     r.Camera,
+				Lens:       r.Lens,
+				From:       r.From,
+				To:         r.To,
+				MinRating:  r.MinRating,
+				MaxRating:  r.MaxRating,
+				Labels:     r.Labels,
+			})
+		}
+		byOperation[operation] = filters.New(operationRules)
+	}
+	return byOperation
 }
 
 func toSortingCtiteria(cfg config.Config) sorting.SortCriteria {
 	return sorting.SortCriteria{
-		FileTypes:       []string{".jpg", ".png", ".mp4", ".mov"},
-		RawPath:         cfg.RawPath(),
-		LocalRawPath:    cfg.LocalRawPath(),
-		LocalEditedPath: cfg.LocalEditedPath(),
-		BackupPath:      cfg.BackupPath(),
-		MoveFiles:       cfg.MoveFiles(),
-		CopyFiles:       cfg.CopyFiles(),
+		FileTypes:        append(append([]string{}, images.GetImageTypes()...), video.GetVideoTypes()...),
+		RawPath:          cfg.RawPath(),
+		LocalRawPath:     cfg.LocalRawPath(),
+		LocalEditedPath:  cfg.LocalEditedPath(),
+		BackupPath:       cfg.BackupPath(),
+		MoveFiles:        cfg.MoveFiles(),
+		CopyFiles:        cfg.CopyFiles(),
+		Collisions:       cfg.Collisions(),
+		Duplicates:       cfg.Duplicates(),
+		Since:            cfg.Since(),
+		TimestampSources: cfg.TimestampSources(),
+		QuarantineDir:    cfg.QuarantineDir(),
+		ClockOffsets:     toOffsetRules(cfg.ClockOffsets()),
+		TimeZone:         cfg.TimeZone(),
+		ShootTimeZone:    cfg.ShootTimeZone(),
+		Filters:          toFilters(cfg.Filters()),
+		ReadJobs:         cfg.ReadJobs(),
+		WriteJobs:        cfg.WriteJobs(),
+
+		ImportTemplate:       cfg.ImportTemplate(),
+		RawBackupTemplate:    cfg.RawBackupTemplate(),
+		EditedBackupTemplate: cfg.EditedBackupTemplate(),
+		UploadTemplate:       cfg.UploadTemplate(),
 	}
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/downing/media-manager/domain/sorting"
+	"github.com/downing/media-manager/pkg/config"
+	"go.uber.org/zap"
+)
+
+func planOperations(ctx context.Context, logger *zap.Logger, cfg config.Config, sortingService *sorting.Service) error {
+	logger.Info("Starting plan of enabled operations")
+
+	plan := sorting.Plan{CreatedAt: time.Now()}
+	planners := []struct {
+		enabled bool
+		plan    func(ctx context.Context) ([]sorting.PlannedAction, error)
+	}{
+		{cfg.ImportRaw(), sortingService.PlanImportRawFiles},
+		{cfg.BackupRaw(), sortingService.PlanBackupLocalRawFiles},
+		{cfg.BackupEdited(), sortingService.PlanBackupEditedFiles},
+		{cfg.UploadEdited(), sortingService.PlanUploadEditedFiles},
+	}
+	for _, planner := range planners {
+		if !planner.enabled {
+			continue
+		}
+		actions, err := planner.plan(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to plan operation: %w", err)
+		}
+		plan.Actions = append(plan.Actions, actions...)
+	}
+
+	var out io.Writer = os.Stdout
+	if cfg.PlanOutput() != "" {
+		file, err := os.Create(cfg.PlanOutput())
+		if err != nil {
+			return fmt.Errorf("failed to create plan file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	err := sorting.WritePlan(out, plan, cfg.PlanFormat())
+	if err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	logger.Info("Plan completed", zap.Int("action_count", len(plan.Actions)), zap.String("plan_output", cfg.PlanOutput()))
+	return nil
+}
+
+func executePlan(ctx context.Context, logger *zap.Logger, path string, sortingService *sorting.Service) error {
+	logger.Info("Starting execution of saved plan", zap.String("plan", path))
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open plan file: %w", err)
+	}
+	defer file.Close()
+
+	plan, err := sorting.ReadPlan(file)
+	if err != nil {
+		return err
+	}
+
+	err = sortingService.ExecutePlan(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("failed to execute plan: %w", err)
+	}
+
+	logger.Info("Execution of saved plan completed")
+	return nil
+}
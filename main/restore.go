@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/downing/media-manager/domain/sorting"
+	"go.uber.org/zap"
+)
+
+// runRestore copies missing local files back from their backups, or prints
+// what would be restored in dry run mode.
+func runRestore(a *app, o *options) int {
+	logger := a.logger
+	logger.Info("Starting restore from backup", zap.String("restore_to", o.restoreTo))
+
+	actions, err := a.sortingService.PlanRestore(o.restoreTo, a.cfg.Since())
+	if err != nil {
+		logger.Error("Failed to plan restore", zap.Error(err))
+		return exitFailure
+	}
+
+	if a.cfg.DryRun() {
+		err := sorting.WritePlan(os.Stdout, sorting.Plan{CreatedAt: time.Now(), Actions: actions}, a.cfg.PlanFormat())
+		if err != nil {
+			logger.Error("Failed to write plan", zap.Error(err))
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	_, failed, err := a.sortingService.Restore(a.ctx, actions)
+	if err != nil {
+		return a.stopped("Failed to restore files", err)
+	}
+	a.stats.FinalStats(logger)
+
+	if len(failed) > 0 {
+		logger.Error("Some files failed verification after restore", zap.Strings("files", failed))
+		return exitPartialFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// notifyInterrupt returns a context that is cancelled on the first SIGINT or
+// SIGTERM, so the run stops after cleaning up the files in flight. A second
+// signal kills the process as usual. stop releases the signal handling.
+func notifyInterrupt(logger *zap.Logger) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			logger.Warn("Interrupted, stopping once the files in flight are cleaned up, interrupt again to quit at once", zap.String("signal", sig.String()))
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// stopped logs the error a command stopped with and returns its exit code. An
+// interrupted command is not a failure, the stats of what it got done are
+// printed and the next run carries on from there.
+func (a *app) stopped(msg string, err error) int {
+	if !errors.Is(err, context.Canceled) {
+		a.logger.Error(msg, zap.Error(err))
+		return exitFailure
+	}
+	a.stats.FinalStats(a.logger)
+	a.logger.Warn("Interrupted, run again to carry on where this run stopped")
+	return exitInterrupted
+}
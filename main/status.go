@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/domain/sorting"
+	"go.uber.org/zap"
+)
+
+// runStatus plans every operation and prints how many files each would
+// transfer. Operations that cannot be planned show the reason instead.
+func runStatus(a *app, _ *options) int {
+	logger, sortingService := a.logger, a.sortingService
+
+	var entryCount int
+	err := a.catalog.Entries(func(_ catalog.Entry) error {
+		entryCount++
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to read media catalog", zap.Error(err))
+		return exitFailure
+	}
+
+	planners := []struct {
+		name string
+		plan func(ctx context.Context) ([]sorting.PlannedAction, error)
+	}{
+		{"import", sortingService.PlanImportRawFiles},
+		{"backup raw", sortingService.PlanBackupLocalRawFiles},
+		{"backup edited", sortingService.PlanBackupEditedFiles},
+		{"upload", sortingService.PlanUploadEditedFiles},
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Profile: %s, catalogued files: %d\n\n", a.cfg.Profile(), entryCount)
+	fmt.Fprintln(tw, "OPERATION\tPENDING\tSKIPPED\tNOTE")
+	for _, planner := range planners {
+		actions, err := planner.plan(a.ctx)
+		if errors.Is(err, context.Canceled) {
+			return exitInterrupted
+		}
+		if err != nil {
+			logger.Debug("Failed to plan operation", zap.String("operation", planner.name), zap.Error(err))
+			fmt.Fprintf(tw, "%s\t-\t-\t%v\n", planner.name, err)
+			continue
+		}
+
+		var pending, skipped int
+		for _, action := range actions {
+			if action.Action == sorting.ActionSkip {
+				skipped++
+			} else {
+				pending++
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t\n", planner.name, pending, skipped)
+	}
+	if err := tw.Flush(); err != nil {
+		logger.Error("Failed to write status", zap.Error(err))
+		return exitFailure
+	}
+	return exitOK
+}
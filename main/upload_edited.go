@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+
 	"github.com/downing/media-manager/domain/sorting"
 	"go.uber.org/zap"
 )
 
-func uploadEditedFiles(logger *zap.Logger, sortingService *sorting.Service) error {
-	logger.Info(". Starting upload of edited files")
-	logger.Info(": Upload of edited files completed")
+func uploadEditedFiles(ctx context.Context, logger *zap.Logger, sortingService *sorting.Service) error {
+	logger.Info("Starting upload of edited files")
+
+	err := sortingService.UploadEditedFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Upload of edited files completed")
 	return nil
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+)
+
+// runVerify re-hashes the catalogued copies and lists the ones that are
+// missing or changed, exiting with a partial failure if there are any.
+func runVerify(a *app, _ *options) int {
+	result, err := a.sortingService.VerifyDestinations(a.ctx, a.cfg.Since())
+	if err != nil {
+		return a.stopped("Failed to verify catalog", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Checked %d files, %d problems\n", result.Checked, len(result.Problems))
+	if len(result.Problems) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "KIND\tPROBLEM\tDESTINATION\tSOURCE")
+		for _, problem := range result.Problems {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", problem.Kind, problem.Problem, problem.Destination, problem.SourcePath)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		a.logger.Error("Failed to write verify report", zap.Error(err))
+		return exitFailure
+	}
+
+	if len(result.Problems) > 0 {
+		return exitPartialFailure
+	}
+	return exitOK
+}
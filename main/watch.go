@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/downing/media-manager/domain/catalog"
+	"github.com/downing/media-manager/domain/watch"
+	runtimestats "github.com/downing/media-manager/pkg/runtime_stats"
+	"go.uber.org/zap"
+)
+
+// runWatch runs the enabled operations each time a card with new files is
+// mounted at the raw path, until the process is interrupted. The library is
+// only locked and its catalog open while a run works, so scheduled and manual
+// runs can go in between.
+func runWatch(a *app, _ *options) int {
+	if a.cfg.RawPath() == "" {
+		a.logger.Error("Invalid paths in config", zap.Error(a.cfg.PathNotSet("raw_path")))
+		return exitUsage
+	}
+
+	watcher := watch.NewService(a.logger, watch.Options{
+		Path:     a.cfg.RawPath(),
+		Interval: a.cfg.WatchInterval(),
+		Settle:   a.cfg.WatchSettle(),
+	})
+	err := watcher.Run(a.ctx, func() (watch.Session, error) {
+		session := a.session()
+		if err := session.open(libraryWrite); err != nil {
+			session.close()
+			return nil, err
+		}
+		return watchSession{a: session}, nil
+	})
+	if errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	}
+	if err != nil {
+		a.logger.Error("Failed to watch for the raw path", zap.Error(err))
+		return exitFailure
+	}
+	return exitOK
+}
+
+// session returns an app for one run of a long-running command, sharing the
+// config, logger and interrupt handling with a but with its own stats and
+// failures.
+func (a *app) session() *app {
+	return &app{
+		ctx:    a.ctx,
+		stop:   func() {},
+		cfg:    a.cfg,
+		logger: a.logger,
+		stats:  runtimestats.NewStats(),
+	}
+}
+
+// watchSession is the library opened for one watch run.
+type watchSession struct {
+	a *app
+}
+
+func (s watchSession) Volume(id string) (catalog.Volume, bool, error) {
+	return s.a.catalog.Volume(id)
+}
+
+func (s watchSession) PutVolume(volume catalog.Volume) error {
+	return s.a.catalog.PutVolume(volume)
+}
+
+func (s watchSession) Run(context.Context) error {
+	switch code := runOperations(s.a); code {
+	case exitOK:
+		return nil
+	case exitInterrupted:
+		return context.Canceled
+	default:
+		return fmt.Errorf("operations exited with code %d", code)
+	}
+}
+
+func (s watchSession) Close() {
+	s.a.close()
+}
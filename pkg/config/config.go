@@ -2,14 +2,31 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
+	"github.com/downing/media-manager/pkg/pathtemplate"
 	"go.uber.org/zap"
 )
 
-func GetConfig() (Config, error) {
+// GetConfig loads the config file, from configPath or the XDG config
+// directories, and merges it with the env vars. Overrides use the env var
+// names and take precedence over both.
+func GetConfig(configPath string, overrides map[string]string) (Config, error) {
+	configFile := findConfigFile(configPath)
+	fileCfg, err := loadFileConfig(configFile)
+	if err != nil {
+		return Config{}, err
+	}
+
+	environment := fileCfg.environment()
+	for key, value := range overrides {
+		environment[key] = value
+	}
+
 	var envCfg EnvConfig
-	err := env.Parse(&envCfg)
+	err = env.ParseWithOptions(&envCfg, env.Options{Environment: environment})
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to get env config: %w", err)
 	}
@@ -17,10 +34,39 @@ func GetConfig() (Config, error) {
 	cfg := Config{
 		logLevel: envCfg.LogLevel,
 
+		configFile: configFile,
+
+		catalogPath:   envCfg.CatalogPath,
+		failureReport: envCfg.FailureReport,
+
+		collisions: envCfg.Collisions,
+		duplicates: envCfg.Duplicates,
+
+		readJobs:  envCfg.ReadJobs,
+		writeJobs: envCfg.WriteJobs,
+
+		quarantineDir: envCfg.QuarantineDir,
+
 		importRaw:    envCfg.ImportRaw,
 		backupRaw:    envCfg.BackupRaw,
 		backupEdited: envCfg.BackupEdited,
 		uploadEdited: envCfg.UploadEdited,
+
+		uploadDestination: envCfg.UploadDestination,
+
+		dryRun:      envCfg.DryRun,
+		planFormat:  envCfg.PlanFormat,
+		planOutput:  envCfg.PlanOutput,
+		executePlan: envCfg.ExecutePlan,
+
+		watchInterval: envCfg.WatchInterval,
+		watchSettle:   envCfg.WatchSettle,
+	}
+
+	switch cfg.planFormat {
+	case "table", "json":
+	default:
+		return Config{}, fmt.Errorf("invalid plan format: %s, choose from [table, json]", cfg.planFormat)
 	}
 
 	switch envCfg.FileOperation {
@@ -32,42 +78,151 @@ func GetConfig() (Config, error) {
 		return Config{}, fmt.Errorf("invalid file operation: %s, choose from [copy, move]", envCfg.FileOperation)
 	}
 
-	pathCfg, err := parsePathConfig(envCfg.PathConfig)
+	switch cfg.collisions {
+	case "skip-if-identical", "suffix", "error", "overwrite":
+	default:
+		return Config{}, fmt.Errorf("invalid collision policy: %s, choose from [skip-if-identical, suffix, error, overwrite]", cfg.collisions)
+	}
+
+	switch cfg.duplicates {
+	case "skip", "hardlink", "off":
+	default:
+		return Config{}, fmt.Errorf("invalid duplicates policy: %s, choose from [skip, hardlink, off]", cfg.duplicates)
+	}
+
+	if envCfg.Since != "" {
+		cfg.since, err = parseSince(envCfg.Since)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, source := range envCfg.TimestampSources {
+		source = strings.TrimSpace(source)
+		switch source {
+		case "exif", "create_date", "xmp", "filename", "mtime":
+		default:
+			return Config{}, fmt.Errorf("invalid timestamp source: %s, choose from [exif, create_date, xmp, filename, mtime]", source)
+		}
+		cfg.timestampSources = append(cfg.timestampSources, source)
+	}
+	if len(cfg.timestampSources) == 0 {
+		return Config{}, fmt.Errorf("no timestamp sources, choose from [exif, create_date, xmp, filename, mtime]")
+	}
+
+	if cfg.quarantineDir == "" {
+		return Config{}, fmt.Errorf("quarantine_dir must not be empty")
+	}
+
+	cfg.clockOffsets, err = fileCfg.clockOffsets()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid clock_offsets: %w", err)
+	}
+
+	cfg.filters, err = fileCfg.filters()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid filters: %w", err)
+	}
+
+	cfg.timeZone, err = parseTimeZone(envCfg.TimeZone)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid timezone: %w", err)
+	}
+	if envCfg.ShootTimeZone != "" {
+		cfg.shootTimeZone, err = parseTimeZone(envCfg.ShootTimeZone)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid shoot_timezone: %w", err)
+		}
+	}
+
+	if cfg.readJobs < 1 || cfg.writeJobs < 1 {
+		return Config{}, fmt.Errorf("invalid job counts: read_jobs=%d, write_jobs=%d, both must be at least 1", cfg.readJobs, cfg.writeJobs)
+	}
+
+	if cfg.watchInterval <= 0 || cfg.watchSettle < 0 {
+		return Config{}, fmt.Errorf("invalid watch timing: watch_interval=%s must be positive, watch_settle=%s must not be negative", cfg.watchInterval, cfg.watchSettle)
+	}
+
+	templates := []struct {
+		name     string
+		raw      string
+		template *pathtemplate.Template
+	}{
+		{"import_template", envCfg.ImportTemplate, &cfg.importTemplate},
+		{"raw_backup_template", envCfg.RawBackupTemplate, &cfg.rawBackupTemplate},
+		{"edited_backup_template", envCfg.EditedBackupTemplate, &cfg.editedBackupTemplate},
+		{"upload_template", envCfg.UploadTemplate, &cfg.uploadTemplate},
+	}
+	for _, t := range templates {
+		*t.template, err = pathtemplate.Parse(t.raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", t.name, err)
+		}
+	}
+
+	pathCfg, err := fileCfg.profile(envCfg.PathConfig)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to parse path config: %w", err)
 	}
 
+	cfg.profile = pathCfg.name
 	cfg.rawPath = pathCfg.rawPath
 	cfg.localRawPath = pathCfg.localRawPath
 	cfg.localEditedPath = pathCfg.localEditedPath
 	cfg.backupPath = pathCfg.backupPath
+	for _, path := range []struct {
+		value string
+		path  *string
+	}{
+		{envCfg.RawPath, &cfg.rawPath},
+		{envCfg.LocalRawPath, &cfg.localRawPath},
+		{envCfg.LocalEditedPath, &cfg.localEditedPath},
+		{envCfg.BackupPath, &cfg.backupPath},
+	} {
+		if path.value != "" {
+			*path.path = expandPath(path.value)
+		}
+	}
 
 	return cfg, nil
 }
 
-func parsePathConfig(pathCfg string) (pathConfig, error) {
-	switch pathCfg {
-	case "test":
-		return pathConfig{
-			rawPath:         "/Users/downing/Pictures/testing/raw",
-			localRawPath:    "/Users/downing/Pictures/testing/rawsorted",
-			localEditedPath: "/Users/downing/Pictures/testing/edited",
-			backupPath:      "/Users/downing/Pictures/testing/backup",
-		}, nil
-	case "default":
-		return pathConfig{
-			rawPath:         "/Volumes/EOS_DIGITAL/DCIM",
-			localRawPath:    "/Users/downing/Pictures/raw",
-			localEditedPath: "/Users/downing/Pictures/edited",
-			backupPath:      "/Volumes/Seagate new/sorted",
-		}, nil
-	default:
-		return pathConfig{}, fmt.Errorf("unknown path config: %s, choose from [default]", pathCfg)
+func (c Config) LogLevel() string {
+	return c.logLevel
+}
+
+// parseSince accepts a date, in local time, or an RFC3339 timestamp.
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since: %s, use YYYY-MM-DD or RFC3339", value)
 	}
+	return t, nil
 }
 
-func (c Config) LogLevel() string {
-	return c.logLevel
+// parseTimeZone accepts an IANA zone name such as Europe/Paris, Local, UTC or
+// a fixed offset such as +02:00.
+func parseTimeZone(value string) (*time.Location, error) {
+	if t, err := time.Parse("-07:00", value); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(value, offset), nil
+	}
+	zone, err := time.LoadLocation(value)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %s, use a name such as Europe/Paris or an offset such as +02:00", value)
+	}
+	return zone, nil
+}
+
+func (c Config) ConfigFile() string {
+	return c.configFile
+}
+
+func (c Config) Profile() string {
+	return c.profile
 }
 
 func (c Config) RawPath() string {
@@ -94,6 +249,30 @@ func (c Config) MoveFiles() bool {
 	return c.moveFiles
 }
 
+func (c Config) Collisions() string {
+	return c.collisions
+}
+
+func (c Config) Duplicates() string {
+	return c.duplicates
+}
+
+func (c Config) CatalogPath() string {
+	return c.catalogPath
+}
+
+func (c Config) FailureReport() string {
+	return c.failureReport
+}
+
+func (c Config) ReadJobs() int {
+	return c.readJobs
+}
+
+func (c Config) WriteJobs() int {
+	return c.writeJobs
+}
+
 func (c Config) ImportRaw() bool {
 	return c.importRaw
 }
@@ -110,18 +289,129 @@ func (c Config) UploadEdited() bool {
 	return c.uploadEdited
 }
 
+func (c Config) UploadDestination() string {
+	return c.uploadDestination
+}
+
+func (c Config) Since() time.Time {
+	return c.since
+}
+
+func (c Config) TimestampSources() []string {
+	return c.timestampSources
+}
+
+func (c Config) QuarantineDir() string {
+	return c.quarantineDir
+}
+
+func (c Config) ClockOffsets() []ClockOffset {
+	return c.clockOffsets
+}
+
+// Filters returns the filter rules of each operation, by operation name.
+func (c Config) Filters() map[string][]FilterRule {
+	return c.filters
+}
+
+func (c Config) TimeZone() *time.Location {
+	return c.timeZone
+}
+
+// ShootTimeZone returns the zone the files of this run were taken in, or nil.
+func (c Config) ShootTimeZone() *time.Location {
+	return c.shootTimeZone
+}
+
+func (c Config) ImportTemplate() pathtemplate.Template {
+	return c.importTemplate
+}
+
+func (c Config) RawBackupTemplate() pathtemplate.Template {
+	return c.rawBackupTemplate
+}
+
+func (c Config) EditedBackupTemplate() pathtemplate.Template {
+	return c.editedBackupTemplate
+}
+
+func (c Config) UploadTemplate() pathtemplate.Template {
+	return c.uploadTemplate
+}
+
+func (c Config) DryRun() bool {
+	return c.dryRun
+}
+
+func (c Config) PlanFormat() string {
+	return c.planFormat
+}
+
+func (c Config) PlanOutput() string {
+	return c.planOutput
+}
+
+func (c Config) ExecutePlan() string {
+	return c.executePlan
+}
+
+// WatchInterval returns how often watch mode checks the raw path.
+func (c Config) WatchInterval() time.Duration {
+	return c.watchInterval
+}
+
+// WatchSettle returns how long the raw path must stay unchanged before watch
+// mode runs the operations.
+func (c Config) WatchSettle() time.Duration {
+	return c.watchSettle
+}
+
 func (c Config) LogConfig(logger *zap.Logger) {
+	shootTimeZone := ""
+	if c.ShootTimeZone() != nil {
+		shootTimeZone = c.ShootTimeZone().String()
+	}
+	filterRuleCount := 0
+	for _, rules := range c.Filters() {
+		filterRuleCount += len(rules)
+	}
 	logger.Info("Config on startup",
 		zap.String("log_level", c.LogLevel()),
+		zap.String("config_file", c.ConfigFile()),
+		zap.String("profile", c.Profile()),
 		zap.String("raw_path", c.RawPath()),
 		zap.String("local_raw_path", c.LocalRawPath()),
 		zap.String("local_edited_path", c.LocalEditedPath()),
 		zap.String("backup_path", c.BackupPath()),
 		zap.Bool("copy_files", c.CopyFiles()),
 		zap.Bool("move_files", c.MoveFiles()),
+		zap.String("collisions", c.Collisions()),
+		zap.String("duplicates", c.Duplicates()),
+		zap.String("catalog_path", c.CatalogPath()),
+		zap.String("failure_report", c.FailureReport()),
+		zap.Int("read_jobs", c.ReadJobs()),
+		zap.Int("write_jobs", c.WriteJobs()),
+		zap.Time("since", c.Since()),
+		zap.Strings("timestamp_sources", c.TimestampSources()),
+		zap.String("quarantine_dir", c.QuarantineDir()),
+		zap.Int("clock_offset_count", len(c.ClockOffsets())),
+		zap.Int("filter_rule_count", filterRuleCount),
+		zap.Stringer("timezone", c.TimeZone()),
+		zap.String("shoot_timezone", shootTimeZone),
 		zap.Bool("import_raw", c.ImportRaw()),
 		zap.Bool("backup_raw", c.BackupRaw()),
 		zap.Bool("backup_edited", c.BackupEdited()),
 		zap.Bool("upload_edited", c.UploadEdited()),
+		zap.String("upload_destination", c.UploadDestination()),
+		zap.Stringer("import_template", c.ImportTemplate()),
+		zap.Stringer("raw_backup_template", c.RawBackupTemplate()),
+		zap.Stringer("edited_backup_template", c.EditedBackupTemplate()),
+		zap.Stringer("upload_template", c.UploadTemplate()),
+		zap.Bool("dry_run", c.DryRun()),
+		zap.String("plan_format", c.PlanFormat()),
+		zap.String("plan_output", c.PlanOutput()),
+		zap.String("execute_plan", c.ExecutePlan()),
+		zap.Duration("watch_interval", c.WatchInterval()),
+		zap.Duration("watch_settle", c.WatchSettle()),
 	)
 }
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configDirName  = "media-manager"
+	configFileName = "config.yaml"
+)
+
+// findConfigFile returns the explicit path if given, otherwise the first
+// config.yaml found in $XDG_CONFIG_HOME (default ~/.config) and $XDG_CONFIG_DIRS
+// (default /etc/xdg) under a media-manager directory, or "" if there is none.
+func findConfigFile(explicitPath string) string {
+	if explicitPath != "" {
+		return explicitPath
+	}
+
+	dirs := []string{}
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		dirs = append(dirs, configHome)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config"))
+	}
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	dirs = append(dirs, filepath.SplitList(configDirs)...)
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, configDirName, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadFileConfig reads the config file at path, an empty path is an empty
+// config that leaves everything to the env vars.
+func loadFileConfig(path string) (fileConfig, error) {
+	if path == "" {
+		return fileConfig{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileConfig{}, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var fileCfg fileConfig
+	if err := yaml.Unmarshal(data, &fileCfg); err != nil {
+		return fileConfig{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return fileCfg, nil
+}
+
+// environment returns the file settings overlaid with the process environment,
+// so env vars always win over the config file.
+func (f fileConfig) environment() map[string]string {
+	environment := map[string]string{}
+	for key, value := range f.Settings {
+		environment[key] = settingValue(value)
+	}
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		environment[key] = value
+	}
+	return environment
+}
+
+// settingValue formats a setting as an env var, lists are comma separated.
+func settingValue(value any) string {
+	list, ok := value.([]any)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// clockOffsets parses the camera clock corrections, days are on the camera's clock.
+func (f fileConfig) clockOffsets() ([]ClockOffset, error) {
+	offsets := []ClockOffset{}
+	for i, c := range f.ClockOffsets {
+		if c.Camera == "" && c.Serial == "" {
+			return nil, fmt.Errorf("clock offset %d: set camera, serial or both", i+1)
+		}
+		offset, err := time.ParseDuration(c.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("clock offset %d: invalid offset: %s, use a duration such as +1h or -2m30s", i+1, c.Offset)
+		}
+		o := ClockOffset{Camera: c.Camera, Serial: c.Serial, Offset: offset}
+		for _, day := range []struct {
+			name  string
+			value string
+			t     *time.Time
+		}{{"from", c.From, &o.From}, {"to", c.To, &o.To}} {
+			if day.value == "" {
+				continue
+			}
+			*day.t, err = time.Parse(time.DateOnly, day.value)
+			if err != nil {
+				return nil, fmt.Errorf("clock offset %d: invalid %s: %s, use YYYY-MM-DD", i+1, day.name, day.value)
+			}
+		}
+		if !o.From.IsZero() && !o.To.IsZero() && o.To.Before(o.From) {
+			return nil, fmt.Errorf("clock offset %d: to %s is before from %s", i+1, c.To, c.From)
+		}
+		offsets = append(offsets, o)
+	}
+	return offsets, nil
+}
+
+// filterOperations are the operations filter rules can be set for.
+var filterOperations = []string{"import", "raw_backup", "edited_backup", "upload"}
+
+// filters parses the include and exclude rules of each operation.
+func (f fileConfig) filters() (map[string][]FilterRule, error) {
+	filters := map[string][]FilterRule{}
+	for operation, rules := range f.Filters {
+		if !slices.Contains(filterOperations, operation) {
+			return nil, fmt.Errorf("unknown operation: %s, choose from %v", operation, filterOperations)
+		}
+		for i, c := range rules {
+			r, err := c.rule()
+			if err != nil {
+				return nil, fmt.Errorf("%s rule %d: %w", operation, i+1, err)
+			}
+			filters[operation] = append(filters[operation], r)
+		}
+	}
+	return filters, nil
+}
+
+func (c filterRuleConfig) rule() (FilterRule, error) {
+	if c.Action != "include" && c.Action != "exclude" {
+		return FilterRule{}, fmt.Errorf("invalid action: %s, choose from [include, exclude]", c.Action)
+	}
+	r := FilterRule{
+		Action:    c.Action,
+		Path:      c.Path,
+		Camera:    c.Camera,
+		Lens:      c.Lens,
+		MinRating: c.MinRating,
+		MaxRating: c.MaxRating,
+		Labels:    c.Labels,
+	}
+	for _, ext := range c.Extensions {
+		r.Extensions = append(r.Extensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+
+	var err error
+	for _, size := range []struct {
+		name  string
+		value string
+		n     *int64
+	}{{"min_size", c.MinSize, &r.MinSize}, {"max_size", c.MaxSize, &r.MaxSize}} {
+		if size.value == "" {
+			continue
+		}
+		*size.n, err = parseSize(size.value)
+		if err != nil {
+			return FilterRule{}, fmt.Errorf("invalid %s: %s, use bytes or a size such as 500KB or 1MB", size.name, size.value)
+		}
+	}
+	for _, day := range []struct {
+		name  string
+		value string
+		t     *time.Time
+	}{{"from", c.From, &r.From}, {"to", c.To, &r.To}} {
+		if day.value == "" {
+			continue
+		}
+		*day.t, err = time.Parse(time.DateOnly, day.value)
+		if err != nil {
+			return FilterRule{}, fmt.Errorf("invalid %s: %s, use YYYY-MM-DD", day.name, day.value)
+		}
+	}
+	for _, rating := range []*int{c.MinRating, c.MaxRating} {
+		if rating != nil && (*rating < -1 || *rating > 5) {
+			return FilterRule{}, fmt.Errorf("invalid rating: %d, use -1 (rejected) to 5", *rating)
+		}
+	}
+	return r, nil
+}
+
+// sizeUnits are the suffixes a size may have, each 1024 times the last.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseSize parses a number of bytes with an optional unit, such as 1MB.
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// profile returns the named profile, or the default profile when name is empty,
+// with paths expanded. A config without profiles has only the paths set by env vars.
+func (f fileConfig) profile(name string) (pathConfig, error) {
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" && len(f.Profiles) == 0 {
+		return pathConfig{}, nil
+	}
+	if name == "" {
+		return pathConfig{}, fmt.Errorf("no profile selected, set path_config or default_profile, choose from %v", f.profileNames())
+	}
+
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return pathConfig{}, fmt.Errorf("unknown path config: %s, choose from %v", name, f.profileNames())
+	}
+
+	return pathConfig{
+		name:            name,
+		rawPath:         expandPath(profile.RawPath),
+		localRawPath:    expandPath(profile.LocalRawPath),
+		localEditedPath: expandPath(profile.LocalEditedPath),
+		backupPath:      expandPath(profile.BackupPath),
+	}, nil
+}
+
+func (f fileConfig) profileNames() []string {
+	names := []string{}
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandPath expands environment variables and a leading ~ in path.
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
@@ -1,21 +1,68 @@
 package config
 
+import (
+	"time"
+
+	"github.com/downing/media-manager/pkg/pathtemplate"
+)
+
 type EnvConfig struct {
 	LogLevel string `env:"log_level"`
 
 	PathConfig string `env:"path_config"`
 
-	FileOperation string `env:"file_op"`
+	// RawPath and the other paths override the profile's.
+	RawPath         string `env:"raw_path"`
+	LocalRawPath    string `env:"local_raw_path"`
+	LocalEditedPath string `env:"local_edited_path"`
+	BackupPath      string `env:"backup_path"`
+
+	FileOperation string `env:"file_op" envDefault:"copy"`
+
+	Collisions string `env:"collisions" envDefault:"suffix"`
+	Duplicates string `env:"duplicates" envDefault:"skip"`
+
+	CatalogPath   string `env:"catalog_path" envDefault:"media_catalog.db"`
+	FailureReport string `env:"failure_report" envDefault:"media_failures.json"`
+
+	ReadJobs  int `env:"read_jobs" envDefault:"4"`
+	WriteJobs int `env:"write_jobs" envDefault:"2"`
+
+	Since string `env:"since"`
+
+	TimestampSources []string `env:"timestamp_sources" envSeparator:"," envDefault:"exif,create_date,xmp,filename,mtime"`
+	QuarantineDir    string   `env:"quarantine_dir" envDefault:"quarantine"`
+
+	TimeZone      string `env:"timezone" envDefault:"Local"`
+	ShootTimeZone string `env:"shoot_timezone"`
 
 	ImportRaw    bool `env:"import_raw"`
 	BackupRaw    bool `env:"backup_raw"`
 	BackupEdited bool `env:"backup_edited"`
 	UploadEdited bool `env:"upload_edited"`
+
+	UploadDestination string `env:"upload_dest"`
+
+	ImportTemplate       string `env:"import_template" envDefault:"{year}-{month}-{day}/{filename}"`
+	RawBackupTemplate    string `env:"raw_backup_template" envDefault:"raw/year{year}/month{month}/day{day}/{hour}{minute}{second}_{filename}"`
+	EditedBackupTemplate string `env:"edited_backup_template" envDefault:"edited/year{year}/month{month}/day{day}/{hour}{minute}{second}_{filename}"`
+	UploadTemplate       string `env:"upload_template" envDefault:"{year}/{month}/{day}/{hour}{minute}{second}_{filename}"`
+
+	DryRun      bool   `env:"dry_run"`
+	PlanFormat  string `env:"plan_format" envDefault:"table"`
+	PlanOutput  string `env:"plan_output"`
+	ExecutePlan string `env:"execute_plan"`
+
+	WatchInterval time.Duration `env:"watch_interval" envDefault:"2s"`
+	WatchSettle   time.Duration `env:"watch_settle" envDefault:"10s"`
 }
 
 type Config struct {
 	logLevel string
 
+	configFile string
+	profile    string
+
 	rawPath         string
 	localRawPath    string
 	localEditedPath string
@@ -24,15 +71,118 @@ type Config struct {
 	copyFiles bool
 	moveFiles bool
 
+	collisions string
+	duplicates string
+
+	catalogPath   string
+	failureReport string
+
+	readJobs  int
+	writeJobs int
+
+	since time.Time
+
+	timestampSources []string
+	quarantineDir    string
+	clockOffsets     []ClockOffset
+	filters          map[string][]FilterRule
+
+	timeZone      *time.Location
+	shootTimeZone *time.Location
+
 	importRaw    bool
 	backupRaw    bool
 	backupEdited bool
 	uploadEdited bool
+
+	uploadDestination string
+
+	importTemplate       pathtemplate.Template
+	rawBackupTemplate    pathtemplate.Template
+	editedBackupTemplate pathtemplate.Template
+	uploadTemplate       pathtemplate.Template
+
+	dryRun      bool
+	planFormat  string
+	planOutput  string
+	executePlan string
+
+	watchInterval time.Duration
+	watchSettle   time.Duration
+}
+
+// ClockOffset corrects the clock of a camera, picked by model, body serial or
+// both, on the days From to To of the camera's clock, either may be zero.
+type ClockOffset struct {
+	Camera string
+	Serial string
+	Offset time.Duration
+	From   time.Time
+	To     time.Time
+}
+
+// FilterRule includes or excludes the files that meet every condition it
+// sets. Sizes are in bytes, From and To are days and either may be zero.
+type FilterRule struct {
+	Action     string
+	Path       string
+	Extensions []string
+	MinSize    int64
+	MaxSize    int64
+	Camera     string
+	Lens       string
+	From       time.Time
+	To         time.Time
+	MinRating  *int
+	MaxRating  *int
+	Labels     []string
 }
 
 type pathConfig struct {
+	name string
+
 	rawPath         string
 	localRawPath    string
 	localEditedPath string
 	backupPath      string
 }
+
+// fileConfig is the YAML config file. Settings use the same keys as the env
+// vars, which override them.
+type fileConfig struct {
+	DefaultProfile string                        `yaml:"default_profile"`
+	Settings       map[string]any                `yaml:"settings"`
+	Profiles       map[string]profileConfig      `yaml:"profiles"`
+	ClockOffsets   []clockOffsetConfig           `yaml:"clock_offsets"`
+	Filters        map[string][]filterRuleConfig `yaml:"filters"`
+}
+
+type profileConfig struct {
+	RawPath         string `yaml:"raw_path"`
+	LocalRawPath    string `yaml:"local_raw_path"`
+	LocalEditedPath string `yaml:"local_edited_path"`
+	BackupPath      string `yaml:"backup_path"`
+}
+
+type clockOffsetConfig struct {
+	Camera string `yaml:"camera"`
+	Serial string `yaml:"serial"`
+	Offset string `yaml:"offset"`
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+}
+
+type filterRuleConfig struct {
+	Action     string   `yaml:"action"`
+	Path       string   `yaml:"path"`
+	Extensions []string `yaml:"extensions"`
+	MinSize    string   `yaml:"min_size"`
+	MaxSize    string   `yaml:"max_size"`
+	Camera     string   `yaml:"camera"`
+	Lens       string   `yaml:"lens"`
+	From       string   `yaml:"from"`
+	To         string   `yaml:"to"`
+	MinRating  *int     `yaml:"min_rating"`
+	MaxRating  *int     `yaml:"max_rating"`
+	Labels     []string `yaml:"labels"`
+}
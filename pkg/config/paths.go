@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// ValidatePaths checks that every path the enabled operations read from exists
+// and every path they write to is writable, before any work starts.
+func (c Config) ValidatePaths() error {
+	type check struct {
+		name     string
+		path     string
+		writable bool
+	}
+	checks := []check{}
+	if c.importRaw {
+		checks = append(checks,
+			check{"raw_path", c.rawPath, false},
+			check{"local_raw_path", c.localRawPath, true},
+		)
+	}
+	if c.backupRaw {
+		checks = append(checks,
+			check{"local_raw_path", c.localRawPath, c.moveFiles},
+			check{"backup_path", c.backupPath, true},
+		)
+	}
+	if c.backupEdited {
+		checks = append(checks,
+			check{"local_edited_path", c.localEditedPath, c.moveFiles},
+			check{"backup_path", c.backupPath, true},
+		)
+	}
+	if c.uploadEdited {
+		checks = append(checks, check{"local_edited_path", c.localEditedPath, false})
+	}
+
+	for _, ch := range checks {
+		if ch.path == "" {
+			return c.PathNotSet(ch.name)
+		}
+		info, err := os.Stat(ch.path)
+		if err != nil {
+			return fmt.Errorf("%s %s is not accessible: %w", ch.name, ch.path, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s %s is not a directory", ch.name, ch.path)
+		}
+		if ch.writable {
+			if err := checkWritable(ch.path); err != nil {
+				return fmt.Errorf("%s %s is not writable: %w", ch.name, ch.path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// PathNotSet is the error for a path the operations need but neither the
+// profile nor the env vars set.
+func (c Config) PathNotSet(name string) error {
+	if c.profile == "" {
+		return fmt.Errorf("%s is not set, add a profile to the config file or set the %s env var", name, name)
+	}
+	return fmt.Errorf("%s is not set in profile %s or the %s env var", name, c.profile, name)
+}
+
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".media-manager-write-check-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
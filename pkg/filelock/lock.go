@@ -0,0 +1,212 @@
+package filelock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileName is the lock file written at the root of a locked directory.
+const FileName = ".media-manager.lock"
+
+// maxAttempts bounds the retries when the lock file is replaced while it is
+// being locked.
+const maxAttempts = 3
+
+var (
+	// errHeld is returned by tryLock when another process holds the lock.
+	errHeld = errors.New("lock held")
+	// errUnsupported is returned by tryLock on filesystems without advisory locks.
+	errUnsupported = errors.New("advisory locks not supported")
+)
+
+// Holder is the run that holds a lock.
+type Holder struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func (h Holder) String() string {
+	return fmt.Sprintf("pid %d on %s since %s", h.PID, h.Host, h.StartedAt.Format(time.RFC3339))
+}
+
+// HeldError is returned when another run holds the lock.
+type HeldError struct {
+	Path   string
+	Holder Holder
+}
+
+func (e *HeldError) Error() string {
+	if e.Holder.PID == 0 {
+		return fmt.Sprintf("%s is locked by another run that is just starting", filepath.Dir(e.Path))
+	}
+	return fmt.Sprintf("%s is locked by another run, %s, remove %s if that run is no longer running",
+		filepath.Dir(e.Path), e.Holder, e.Path)
+}
+
+// Lock is an advisory lock on a directory, held until Release.
+type Lock struct {
+	path  string
+	file  *os.File
+	stale *Holder
+}
+
+// Acquire locks the directory for this process. The lock file is locked with
+// flock, which the kernel releases when a run crashes, and records the holder
+// so a run that finds it locked can say by whom. On filesystems without
+// flock a lock whose holder is no longer running on this host is taken over.
+func Acquire(dir string) (*Lock, error) {
+	path := filepath.Join(dir, FileName)
+	self, err := currentHolder()
+	if err != nil {
+		return nil, err
+	}
+
+	for range maxAttempts {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file %s: %w", path, err)
+		}
+
+		err = tryLock(file)
+		previous, hasPrevious := readHolder(file)
+		switch {
+		case errors.Is(err, errUnsupported):
+			if hasPrevious && holderRunning(previous) {
+				file.Close()
+				return nil, &HeldError{Path: path, Holder: previous}
+			}
+		case errors.Is(err, errHeld):
+			file.Close()
+			return nil, &HeldError{Path: path, Holder: previous}
+		case err != nil:
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		// the holder that just released the lock may have removed the file,
+		// a lock on the removed file locks nothing
+		if !isCurrent(file, path) {
+			file.Close()
+			continue
+		}
+
+		l := &Lock{path: path, file: file}
+		if hasPrevious {
+			l.stale = &previous
+		}
+		if err := l.write(self); err != nil {
+			l.Release()
+			return nil, err
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("failed to lock %s: lock file kept changing", path)
+}
+
+// Holding returns the holder recorded in the directory's lock file, when
+// there is one.
+func Holding(dir string) (Holder, bool) {
+	file, err := os.Open(filepath.Join(dir, FileName))
+	if err != nil {
+		return Holder{}, false
+	}
+	defer file.Close()
+	return readHolder(file)
+}
+
+// Stale returns the holder of a lock that was left behind by a run that did
+// not release it, and that this lock took over.
+func (l *Lock) Stale() (Holder, bool) {
+	if l.stale == nil {
+		return Holder{}, false
+	}
+	return *l.stale, true
+}
+
+// Path returns the path of the lock file.
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// Release removes the lock file and unlocks it. It is removed first, so a run
+// that opened it meanwhile sees it was replaced and tries again.
+func (l *Lock) Release() error {
+	removeErr := os.Remove(l.path)
+	if errors.Is(removeErr, os.ErrNotExist) {
+		removeErr = nil
+	}
+	unlock(l.file)
+	closeErr := l.file.Close()
+	if removeErr != nil {
+		return fmt.Errorf("failed to remove lock file %s: %w", l.path, removeErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close lock file %s: %w", l.path, closeErr)
+	}
+	return nil
+}
+
+func (l *Lock) write(holder Holder) error {
+	data, err := json.Marshal(holder)
+	if err != nil {
+		return fmt.Errorf("failed to encode lock holder: %w", err)
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write lock file %s: %w", l.path, err)
+	}
+	if _, err := l.file.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("failed to write lock file %s: %w", l.path, err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync lock file %s: %w", l.path, err)
+	}
+	return nil
+}
+
+func currentHolder() (Holder, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return Holder{}, fmt.Errorf("failed to get host name: %w", err)
+	}
+	return Holder{PID: os.Getpid(), Host: host, StartedAt: time.Now().Truncate(time.Second)}, nil
+}
+
+func readHolder(file *os.File) (Holder, bool) {
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 4096))
+	if err != nil || len(data) == 0 {
+		return Holder{}, false
+	}
+	var holder Holder
+	if err := json.Unmarshal(data, &holder); err != nil || holder.PID == 0 {
+		return Holder{}, false
+	}
+	return holder, true
+}
+
+// holderRunning reports whether the holder may still be running. A holder on
+// another host cannot be checked and is assumed to be.
+func holderRunning(holder Holder) bool {
+	host, err := os.Hostname()
+	if err != nil || holder.Host != host {
+		return true
+	}
+	return processRunning(holder.PID)
+}
+
+func isCurrent(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
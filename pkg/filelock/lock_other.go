@@ -0,0 +1,17 @@
+//go:build !unix
+
+package filelock
+
+import "os"
+
+func tryLock(*os.File) error {
+	return errUnsupported
+}
+
+func unlock(*os.File) {}
+
+// processRunning cannot tell on this platform, so a lock left by a crashed
+// run has to be removed by hand.
+func processRunning(int) bool {
+	return true
+}
@@ -0,0 +1,213 @@
+package genutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChecksumManifestFilename is written at the root of each destination tree in
+// the format understood by `sha256sum -c`.
+const ChecksumManifestFilename = "checksums.sha256"
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// HashFile returns the hex encoded SHA-256 of the file at path.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to hash file %s: %w", path, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func (fm *FileManager) HashFile(path string) (string, error) {
+	return HashFile(path)
+}
+
+// RecordChecksum sets the checksum of filePath in the manifest in rootPath.
+// A file new to the manifest is appended at once, a changed checksum is also
+// appended and its earlier line dropped when FlushChecksums rewrites it.
+func (fm *FileManager) RecordChecksum(rootPath, filePath, checksum string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	m, relPath, err := fm.manifest(rootPath, filePath)
+	if err != nil {
+		return err
+	}
+	current, ok := m.lines[relPath]
+	line := fmt.Sprintf("%s  %s", checksum, relPath)
+	if ok && current == line {
+		return nil
+	}
+	if ok {
+		m.dirty = true
+	} else {
+		m.order = append(m.order, relPath)
+	}
+	m.lines[relPath] = line
+	return appendManifest(m.path, line)
+}
+
+// RemoveChecksum drops the line of filePath from the manifest in rootPath,
+// for a file moved out of the tree, when FlushChecksums rewrites it.
+func (fm *FileManager) RemoveChecksum(rootPath, filePath string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	m, relPath, err := fm.manifest(rootPath, filePath)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.lines[relPath]; ok {
+		delete(m.lines, relPath)
+		m.dirty = true
+	}
+	return nil
+}
+
+// FlushChecksums rewrites the manifests whose lines changed or were removed
+// since they were loaded, once at the end of a run, and forgets every loaded
+// manifest so the next run reads them afresh.
+func (fm *FileManager) FlushChecksums() error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	var errs []error
+	for _, m := range fm.manifests {
+		if m.dirty {
+			errs = append(errs, m.write())
+		}
+	}
+	fm.manifests = nil
+	return errors.Join(errs...)
+}
+
+// checksumManifest is a manifest loaded for a run. lines holds the line of
+// each path, keyed by the path, and order is the order paths were first seen.
+// Lines that are not checksums are kept as they are.
+type checksumManifest struct {
+	path  string
+	order []string
+	lines map[string]string
+	dirty bool
+}
+
+// manifest returns the manifest in rootPath, loading it on first use, and the
+// path of filePath in it.
+func (fm *FileManager) manifest(rootPath, filePath string) (*checksumManifest, string, error) {
+	relPath, err := filepath.Rel(rootPath, filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get path of %s relative to %s: %w", filePath, rootPath, err)
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	manifestPath := filepath.Join(rootPath, ChecksumManifestFilename)
+	if m, ok := fm.manifests[manifestPath]; ok {
+		return m, relPath, nil
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, "", fmt.Errorf("failed to read checksum manifest %s: %w", manifestPath, err)
+	}
+	m := &checksumManifest{path: manifestPath, lines: map[string]string{}}
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSuffix(line, "\n")
+		key := "\x00" + line
+		if _, path, ok := strings.Cut(line, "  "); ok {
+			key = path
+		}
+		// a file recorded again keeps its last line
+		if _, ok := m.lines[key]; ok {
+			m.dirty = true
+		} else {
+			m.order = append(m.order, key)
+		}
+		m.lines[key] = line
+	}
+
+	if fm.manifests == nil {
+		fm.manifests = map[string]*checksumManifest{}
+	}
+	fm.manifests[manifestPath] = m
+	return m, relPath, nil
+}
+
+// write replaces the manifest with its lines through a temporary file so it
+// is never left half written. A manifest with no lines is removed, as
+// sha256sum rejects it.
+func (m *checksumManifest) write() error {
+	var content strings.Builder
+	written := map[string]bool{}
+	for _, key := range m.order {
+		// a path removed and recorded again is in order twice
+		if line, ok := m.lines[key]; ok && !written[key] {
+			content.WriteString(line + "\n")
+			written[key] = true
+		}
+	}
+	m.dirty = false
+
+	if content.Len() == 0 {
+		if err := os.Remove(m.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove empty checksum manifest %s: %w", m.path, err)
+		}
+		return syncDir(filepath.Dir(m.path))
+	}
+	return rewriteManifest(m.path, content.String())
+}
+
+func appendManifest(manifestPath, line string) error {
+	manifest, err := os.OpenFile(manifestPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open checksum manifest %s: %w", manifestPath, err)
+	}
+	defer manifest.Close()
+
+	if _, err := fmt.Fprintln(manifest, line); err != nil {
+		return fmt.Errorf("failed to write checksum manifest %s: %w", manifestPath, err)
+	}
+	return nil
+}
+
+func rewriteManifest(manifestPath, content string) error {
+	dir := filepath.Dir(manifestPath)
+	tempFile, err := os.CreateTemp(dir, "."+ChecksumManifestFilename+tempFileMarker+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in %s: %w", dir, err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+
+	_, err = tempFile.WriteString(content)
+	if err == nil {
+		err = tempFile.Chmod(0644)
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write checksum manifest %s: %w", manifestPath, err)
+	}
+
+	if err := os.Rename(tempPath, manifestPath); err != nil {
+		return fmt.Errorf("failed to replace checksum manifest %s: %w", manifestPath, err)
+	}
+	return syncDir(dir)
+}
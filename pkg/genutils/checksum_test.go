@@ -0,0 +1,112 @@
+package genutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordChecksum(t *testing.T) {
+	root := t.TempDir()
+	fm := NewFileManager()
+	record := func(path, checksum string) {
+		t.Helper()
+		if err := fm.RecordChecksum(root, filepath.Join(root, path), checksum); err != nil {
+			t.Fatalf("RecordChecksum() error = %v", err)
+		}
+	}
+
+	record("2023/IMG_0001.CR2", "aaaa")
+	record("2023/IMG_0002.CR2", "bbbb")
+	record("2023/IMG_0001.CR2", "aaaa")
+	assertManifest(t, root, "aaaa  2023/IMG_0001.CR2\nbbbb  2023/IMG_0002.CR2\n")
+
+	// a changed checksum is appended at once and its old line dropped on flush
+	record("2023/IMG_0001.CR2", "cccc")
+	assertManifest(t, root, "aaaa  2023/IMG_0001.CR2\nbbbb  2023/IMG_0002.CR2\ncccc  2023/IMG_0001.CR2\n")
+	flush(t, fm)
+	assertManifest(t, root, "cccc  2023/IMG_0001.CR2\nbbbb  2023/IMG_0002.CR2\n")
+}
+
+func TestRecordChecksumDeduplicates(t *testing.T) {
+	root := t.TempDir()
+	manifest := "aaaa  2023/IMG_0001.CR2\nbbbb  2023/IMG_0002.CR2\ncccc  2023/IMG_0001.CR2\n"
+	if err := os.WriteFile(filepath.Join(root, ChecksumManifestFilename), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fm := NewFileManager()
+
+	if err := fm.RecordChecksum(root, filepath.Join(root, "2023", "IMG_0001.CR2"), "cccc"); err != nil {
+		t.Fatalf("RecordChecksum() error = %v", err)
+	}
+	assertManifest(t, root, manifest)
+	flush(t, fm)
+	assertManifest(t, root, "cccc  2023/IMG_0001.CR2\nbbbb  2023/IMG_0002.CR2\n")
+}
+
+func TestRemoveChecksum(t *testing.T) {
+	root := t.TempDir()
+	fm := NewFileManager()
+
+	if err := fm.RemoveChecksum(root, filepath.Join(root, "2023", "IMG_0001.CR2")); err != nil {
+		t.Fatalf("RemoveChecksum() without a manifest error = %v", err)
+	}
+	flush(t, fm)
+	if _, err := os.Stat(filepath.Join(root, ChecksumManifestFilename)); !os.IsNotExist(err) {
+		t.Errorf("RemoveChecksum() without a manifest created one, stat error = %v", err)
+	}
+
+	for _, path := range []string{"2023/IMG_0001.CR2", "2023/IMG_0002.CR2", "2023/IMG_0003.CR2"} {
+		if err := fm.RecordChecksum(root, filepath.Join(root, path), "aaaa"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flush(t, fm)
+	for _, path := range []string{"2023/IMG_0001.CR2", "2023/IMG_0003.CR2"} {
+		if err := fm.RemoveChecksum(root, filepath.Join(root, path)); err != nil {
+			t.Fatalf("RemoveChecksum() error = %v", err)
+		}
+	}
+	// removed and recorded again, the file keeps a single line
+	if err := fm.RecordChecksum(root, filepath.Join(root, "2023", "IMG_0003.CR2"), "bbbb"); err != nil {
+		t.Fatal(err)
+	}
+	flush(t, fm)
+	assertManifest(t, root, "aaaa  2023/IMG_0002.CR2\nbbbb  2023/IMG_0003.CR2\n")
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("root holds %d entries, want only the manifest", len(entries))
+	}
+
+	for _, path := range []string{"2023/IMG_0002.CR2", "2023/IMG_0003.CR2"} {
+		if err := fm.RemoveChecksum(root, filepath.Join(root, path)); err != nil {
+			t.Fatalf("RemoveChecksum() error = %v", err)
+		}
+	}
+	flush(t, fm)
+	if _, err := os.Stat(filepath.Join(root, ChecksumManifestFilename)); !os.IsNotExist(err) {
+		t.Errorf("emptied manifest kept, stat error = %v", err)
+	}
+}
+
+func flush(t *testing.T, fm *FileManager) {
+	t.Helper()
+	if err := fm.FlushChecksums(); err != nil {
+		t.Fatalf("FlushChecksums() error = %v", err)
+	}
+}
+
+func assertManifest(t *testing.T, root, want string) {
+	t.Helper()
+	got, err := os.ReadFile(filepath.Join(root, ChecksumManifestFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("manifest = %q, want %q", got, want)
+	}
+}
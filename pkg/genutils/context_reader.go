@@ -0,0 +1,24 @@
+package genutils
+
+import (
+	"context"
+	"io"
+)
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// NewContextReader returns a reader that fails with ctx's error once ctx is
+// cancelled, so a long copy stops between reads.
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -1,12 +1,30 @@
 package genutils
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 )
 
-type FileManager struct{}
+const (
+	compareBufferSize = 64 * 1024
+	tempFileMarker    = ".mm-partial-"
+)
+
+type FileManager struct {
+	mu sync.Mutex
+	// manifests are the checksum manifests loaded by the current run, by path.
+	manifests map[string]*checksumManifest
+}
 
 func NewFileManager() *FileManager {
 	return &FileManager{}
@@ -66,45 +84,247 @@ func (fm *FileManager) DoesPathExist(path string) (bool, error) {
 	return true, nil
 }
 
-func (fm *FileManager) MoveFile(sourcePath, destinationPath string) error {
+func (fm *FileManager) GetFileInfo(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %w", path, err)
+	}
+	return info, nil
+}
+
+// MoveFile renames the file into place, falling back to copy, verify and delete
+// when the destination is on a different filesystem. The source is only removed
+// once the copy matches it byte for byte. It returns the SHA-256 of the file.
+// A move that was cancelled or could not be verified leaves the source in
+// place and nothing at the destination. Both directories are synced so the
+// move is durable.
+func (fm *FileManager) MoveFile(ctx context.Context, sourcePath, destinationPath string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	destDir := filepath.Dir(destinationPath)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create destination directory %s: %w", destDir, err)
+	}
+
 	err := os.Rename(sourcePath, destinationPath)
+	if err == nil {
+		for _, dir := range []string{destDir, filepath.Dir(sourcePath)} {
+			if err := syncDir(dir); err != nil {
+				return "", fmt.Errorf("failed to sync directory %s after move: %w", dir, err)
+			}
+		}
+		return HashFile(destinationPath)
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return "", fmt.Errorf("failed to move file from %s to %s: %w", sourcePath, destinationPath, err)
+	}
+
+	checksum, err := fm.CopyFile(ctx, sourcePath, destinationPath)
 	if err != nil {
-		return fmt.Errorf("failed to move file from %s to %s: %w", sourcePath, destinationPath, err)
+		return "", fmt.Errorf("failed to move file across devices from %s to %s: %w", sourcePath, destinationPath, err)
 	}
-	return nil
+
+	// a copy that cannot be verified is removed, so it is never taken for the file
+	equal, err := filesEqual(sourcePath, destinationPath)
+	if err != nil {
+		err = fmt.Errorf("failed to verify moved file %s against %s: %w", destinationPath, sourcePath, err)
+	} else if !equal {
+		err = fmt.Errorf("moved file %s does not match source %s, source kept: %w", destinationPath, sourcePath, ErrChecksumMismatch)
+	}
+	if err != nil {
+		if removeErr := fm.RemoveFile(destinationPath); removeErr != nil {
+			return "", fmt.Errorf("%w, and failed to remove the unverified copy: %w", err, removeErr)
+		}
+		return "", err
+	}
+
+	if err := fm.RemoveFile(sourcePath); err != nil {
+		return "", fmt.Errorf("failed to remove source file %s after move: %w", sourcePath, err)
+	}
+	return checksum, nil
 }
 
-func (fm *FileManager) CopyFile(sourcePath, destinationPath string) error {
+// CopyFile copies into a temporary sibling of the destination while hashing the
+// source, re-reads the copy to verify it, syncs it and renames it into place so
+// an interrupted or corrupt copy never appears at the destination. It returns
+// the SHA-256 of the file. Cancelling ctx stops the copy and removes the
+// temporary file.
+func (fm *FileManager) CopyFile(ctx context.Context, sourcePath, destinationPath string) (string, error) {
 	sourceFile, err := os.Open(sourcePath)
 	if err != nil {
-		return fmt.Errorf("failed to open source file %s: %w", sourcePath, err)
+		return "", fmt.Errorf("failed to open source file %s: %w", sourcePath, err)
 	}
 	defer sourceFile.Close()
 
-	sourceInfo, err := os.Stat(sourcePath)
+	sourceInfo, err := sourceFile.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to stat source file %s: %w", sourcePath, err)
+		return "", fmt.Errorf("failed to stat source file %s: %w", sourcePath, err)
 	}
 
 	destDir := filepath.Dir(destinationPath)
 	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory %s: %w", destDir, err)
+		return "", fmt.Errorf("failed to create destination directory %s: %w", destDir, err)
 	}
 
-	destFile, err := os.Create(destinationPath)
+	tempFile, err := os.CreateTemp(destDir, "."+filepath.Base(destinationPath)+tempFileMarker+"*")
 	if err != nil {
-		return fmt.Errorf("failed to create destination file %s: %w", destinationPath, err)
+		return "", fmt.Errorf("failed to create temporary file in %s: %w", destDir, err)
 	}
-	defer destFile.Close()
+	tempPath := tempFile.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tempFile.Close()
+			os.Remove(tempPath)
+		}
+	}()
 
-	_, err = destFile.ReadFrom(sourceFile)
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tempFile, hasher), NewContextReader(ctx, sourceFile))
 	if err != nil {
-		return fmt.Errorf("failed to copy data from source file %s to destination file %s: %w", sourcePath, destinationPath, err)
+		return "", fmt.Errorf("failed to copy data from source file %s to destination file %s: %w", sourcePath, destinationPath, err)
 	}
+	sourceChecksum := hex.EncodeToString(hasher.Sum(nil))
 
-	if err := os.Chtimes(destinationPath, sourceInfo.ModTime(), sourceInfo.ModTime()); err != nil {
-		return fmt.Errorf("failed to set timestamps on destination file %s: %w", destinationPath, err)
+	if err := tempFile.Chmod(0644); err != nil {
+		return "", fmt.Errorf("failed to set permissions on temporary file %s: %w", tempPath, err)
 	}
 
+	if err := tempFile.Sync(); err != nil {
+		return "", fmt.Errorf("failed to sync temporary file %s: %w", tempPath, err)
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return "", fmt.Errorf("failed to close temporary file %s: %w", tempPath, err)
+	}
+
+	destChecksum, err := HashFile(tempPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify destination file %s: %w", destinationPath, err)
+	}
+	if destChecksum != sourceChecksum {
+		return "", fmt.Errorf("copy of %s to %s has checksum %s, expected %s: %w", sourcePath, destinationPath, destChecksum, sourceChecksum, ErrChecksumMismatch)
+	}
+
+	if err := os.Chtimes(tempPath, sourceInfo.ModTime(), sourceInfo.ModTime()); err != nil {
+		return "", fmt.Errorf("failed to set timestamps on destination file %s: %w", destinationPath, err)
+	}
+
+	if err := os.Rename(tempPath, destinationPath); err != nil {
+		return "", fmt.Errorf("failed to rename temporary file %s to %s: %w", tempPath, destinationPath, err)
+	}
+	committed = true
+
+	if err := syncDir(destDir); err != nil {
+		return "", fmt.Errorf("failed to sync destination directory %s: %w", destDir, err)
+	}
+
+	return sourceChecksum, nil
+}
+
+// RemoveFile deletes the file and syncs its directory so the removal is durable.
+func (fm *FileManager) RemoveFile(path string) error {
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove file %s: %w", path, err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", filepath.Dir(path), err)
+	}
+	return nil
+}
+
+// LinkFile hard links an existing file to the destination, so both paths share
+// the same data on disk. Both paths must be on the same filesystem.
+func (fm *FileManager) LinkFile(existingPath, destinationPath string) error {
+	destDir := filepath.Dir(destinationPath)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory %s: %w", destDir, err)
+	}
+
+	if err := os.Link(existingPath, destinationPath); err != nil {
+		return fmt.Errorf("failed to link file %s to %s: %w", existingPath, destinationPath, err)
+	}
+
+	if err := syncDir(destDir); err != nil {
+		return fmt.Errorf("failed to sync destination directory %s: %w", destDir, err)
+	}
 	return nil
 }
+
+// RemoveStaleTempFiles deletes temporary copy files left behind by interrupted runs under path.
+func (fm *FileManager) RemoveStaleTempFiles(path string) (int, error) {
+	exists, err := fm.DoesPathExist(path)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var removed int
+	err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to walk directory %s: %w", path, err)
+		}
+		if d.IsDir() || !isTempFile(d.Name()) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return fmt.Errorf("failed to remove temporary file %s: %w", p, err)
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to remove stale temporary files in %s: %w", path, err)
+	}
+	return removed, nil
+}
+
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempFileMarker)
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func filesEqual(pathA, pathB string) (bool, error) {
+	fileA, err := os.Open(pathA)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file %s: %w", pathA, err)
+	}
+	defer fileA.Close()
+
+	fileB, err := os.Open(pathB)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file %s: %w", pathB, err)
+	}
+	defer fileB.Close()
+
+	bufA := make([]byte, compareBufferSize)
+	bufB := make([]byte, compareBufferSize)
+	for {
+		nA, errA := io.ReadFull(fileA, bufA)
+		nB, errB := io.ReadFull(fileB, bufB)
+		if !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !doneA {
+			return false, fmt.Errorf("failed to read file %s: %w", pathA, errA)
+		}
+		if errB != nil && !doneB {
+			return false, fmt.Errorf("failed to read file %s: %w", pathB, errB)
+		}
+		if doneA || doneB {
+			return doneA && doneB, nil
+		}
+	}
+}
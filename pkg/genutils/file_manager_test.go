@@ -0,0 +1,51 @@
+package genutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveFile(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "IMG_0001.CR2")
+	if err := os.WriteFile(source, []byte("raw"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "2023", "IMG_0001.CR2")
+
+	checksum, err := NewFileManager().MoveFile(context.Background(), source, dest)
+	if err != nil {
+		t.Fatalf("MoveFile() error = %v", err)
+	}
+	want, err := HashFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum != want {
+		t.Errorf("MoveFile() checksum = %s, want %s", checksum, want)
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("source still exists after move, stat error = %v", err)
+	}
+}
+
+func TestMoveFileCancelled(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "IMG_0001.CR2")
+	if err := os.WriteFile(source, []byte("raw"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "IMG_0001.CR2")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewFileManager().MoveFile(ctx, source, dest); err == nil {
+		t.Fatal("MoveFile() error = nil, want the context error")
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Errorf("source missing after cancelled move: %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("destination exists after cancelled move, stat error = %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package pathtemplate
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	TokenYear      = "year"
+	TokenMonth     = "month"
+	TokenDay       = "day"
+	TokenHour      = "hour"
+	TokenMinute    = "minute"
+	TokenSecond    = "second"
+	TokenDate      = "date"
+	TokenCamera    = "camera"
+	TokenFileName  = "filename"
+	TokenName      = "name"
+	TokenExt       = "ext"
+	TokenSeq       = "seq"
+	TokenSourceDir = "source_dir"
+	TokenLens      = "lens"
+	TokenFocal     = "focal"
+	TokenAperture  = "aperture"
+	TokenShutter   = "shutter"
+	TokenISO       = "iso"
+	TokenRating    = "rating"
+)
+
+// Tokens are the placeholders a template may use.
+var Tokens = []string{
+	TokenYear, TokenMonth, TokenDay, TokenHour, TokenMinute, TokenSecond, TokenDate,
+	TokenCamera, TokenFileName, TokenName, TokenExt, TokenSeq, TokenSourceDir,
+	TokenLens, TokenFocal, TokenAperture, TokenShutter, TokenISO, TokenRating,
+}
+
+// Fields maps token names to their values for one file.
+type Fields map[string]string
+
+// Template is a destination path relative to a base directory, with {token}
+// placeholders such as {year}/{month}/{camera}/{seq}_{name}{ext}.
+type Template struct {
+	raw   string
+	parts []part
+}
+
+type part struct {
+	literal string
+	token   string
+}
+
+// Parse checks the template only uses known tokens and stays inside its base directory.
+func Parse(raw string) (Template, error) {
+	if strings.TrimSpace(raw) == "" {
+		return Template{}, fmt.Errorf("empty path template")
+	}
+	if path.IsAbs(raw) {
+		return Template{}, fmt.Errorf("path template %q must be relative", raw)
+	}
+	for _, segment := range strings.Split(raw, "/") {
+		if segment == ".." {
+			return Template{}, fmt.Errorf("path template %q must not contain '..'", raw)
+		}
+	}
+
+	known := map[string]bool{}
+	for _, token := range Tokens {
+		known[token] = true
+	}
+
+	t := Template{raw: raw}
+	rest := raw
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		close := strings.IndexByte(rest, '}')
+		if open < 0 {
+			if close >= 0 {
+				return Template{}, fmt.Errorf("path template %q has '}' without '{'", raw)
+			}
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+		if close < open {
+			return Template{}, fmt.Errorf("path template %q has unbalanced braces", raw)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{literal: rest[:open]})
+		}
+
+		token := rest[open+1 : close]
+		if !known[token] {
+			return Template{}, fmt.Errorf("path template %q uses unknown token {%s}, choose from %s", raw, token, tokenList(Tokens))
+		}
+		t.parts = append(t.parts, part{token: token})
+		rest = rest[close+1:]
+	}
+
+	if !strings.Contains(raw, "{") {
+		return Template{}, fmt.Errorf("path template %q has no tokens, every file would get the same path", raw)
+	}
+	return t, nil
+}
+
+// Render fills in the tokens. Path separators in values are replaced so a
+// value can never add directories.
+func (t Template) Render(fields Fields) string {
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.token == "" {
+			sb.WriteString(p.literal)
+			continue
+		}
+		sb.WriteString(strings.NewReplacer("/", "_", "\\", "_").Replace(fields[p.token]))
+	}
+	return sb.String()
+}
+
+func (t Template) String() string {
+	return t.raw
+}
+
+func tokenList(tokens []string) string {
+	sorted := append([]string{}, tokens...)
+	sort.Strings(sorted)
+	return "{" + strings.Join(sorted, "}, {") + "}"
+}
@@ -2,81 +2,124 @@ package runtimestats
 
 import (
 	"fmt"
+	"sync"
 
 	"go.uber.org/zap"
 )
 
+const (
+	RawFilesChecked  = "raw_files_checked"
+	RawFilesFound    = "raw_files_found"
+	RawFilesImported = "raw_files_imported"
+
+	LocalRawFilesChecked = "local_raw_files_checked"
+	LocalRawFilesFound   = "local_raw_files_found"
+	LocalRawFilesMoved   = "local_raw_files_moved"
+	LocalRawFilesCopied  = "local_raw_files_copied"
+
+	LocalEditedFilesChecked = "local_edited_files_checked"
+	LocalEditedFilesFound   = "local_edited_files_found"
+	LocalEditedFilesMoved   = "local_edited_files_moved"
+	LocalEditedFilesCopied  = "local_edited_files_copied"
+
+	ToUploadFilesChecked  = "to_upload_files_checked"
+	ToUploadFilesFound    = "to_upload_files_found"
+	ToUploadFilesUploaded = "to_upload_files_uploaded"
+
+	DuplicatesSkipped = "duplicates_skipped"
+	DuplicatesLinked  = "duplicates_linked"
+
+	FilesQuarantined = "files_quarantined"
+	FilesExcluded    = "files_excluded"
+
+	ChecksumErrors = "checksum_errors"
+	FilesFailed    = "files_failed"
+)
+
+// Stats holds named run counters and is safe for concurrent use.
 type Stats struct {
-	RawFilesChecked  int
-	RawFilesFound    int
-	RawFilesImported int
-
-	LocalRawFilesChecked int
-	LocalRawFilesFound   int
-	LocalRawFilesMoved   int
-	LocalRawFilesCopied  int
-
-	LocalEditedFilesChecked int
-	LocalEditedFilesFound   int
-	LocalEditedFilesMoved   int
-	LocalEditedFilesCopied  int
-
-	ToUploadFilesChecked  int
-	ToUploadFilesFound    int
-	ToUploadFilesUploaded int
+	mu       sync.Mutex
+	counters map[string]int
 }
 
 func NewStats() *Stats {
-	return &Stats{}
+	return &Stats{
+		counters: map[string]int{},
+	}
+}
+
+func (s *Stats) IncrementCounter(name string) {
+	s.AddToCounter(name, 1)
+}
+
+func (s *Stats) AddToCounter(name string, delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[name] += delta
+}
+
+func (s *Stats) Counter(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[name]
 }
 
 func (s *Stats) FinalStats(logger *zap.Logger) {
-	logger.Info("Raw Statistics",
-		zap.Int("raw_files_checked", s.RawFilesChecked),
-		zap.Int("raw_files_found", s.RawFilesFound),
-		zap.Int("raw_files_imported", s.RawFilesImported),
-
-		zap.Int("local_raw_files_checked", s.LocalRawFilesChecked),
-		zap.Int("local_raw_files_found", s.LocalRawFilesFound),
-		zap.Int("local_raw_files_moved", s.LocalRawFilesMoved),
-		zap.Int("local_raw_files_copied", s.LocalRawFilesCopied),
-
-		zap.Int("local_edited_files_checked", s.LocalEditedFilesChecked),
-		zap.Int("local_edited_files_found", s.LocalEditedFilesFound),
-		zap.Int("local_edited_files_moved", s.LocalEditedFilesMoved),
-		zap.Int("local_edited_files_copied", s.LocalEditedFilesCopied),
-
-		zap.Int("to_upload_files_checked", s.ToUploadFilesChecked),
-		zap.Int("to_upload_files_found", s.ToUploadFilesFound),
-		zap.Int("to_upload_files_uploaded", s.ToUploadFilesUploaded),
-	)
+	fields := []zap.Field{}
+	for _, name := range []string{
+		RawFilesChecked, RawFilesFound, RawFilesImported,
+		LocalRawFilesChecked, LocalRawFilesFound, LocalRawFilesMoved, LocalRawFilesCopied,
+		LocalEditedFilesChecked, LocalEditedFilesFound, LocalEditedFilesMoved, LocalEditedFilesCopied,
+		ToUploadFilesChecked, ToUploadFilesFound, ToUploadFilesUploaded,
+		DuplicatesSkipped, DuplicatesLinked,
+		FilesQuarantined, FilesExcluded,
+		ChecksumErrors, FilesFailed,
+	} {
+		fields = append(fields, zap.Int(name, s.Counter(name)))
+	}
+	logger.Info("Raw Statistics", fields...)
 
 	logMsg := "Raw Files:          Checked: %d, Found: %d, Imported: %d"
 	logger.Info(
-		fmt.Sprintf(logMsg, s.RawFilesChecked, s.RawFilesFound, s.RawFilesImported),
+		fmt.Sprintf(logMsg, s.Counter(RawFilesChecked), s.Counter(RawFilesFound), s.Counter(RawFilesImported)),
 	)
 
 	logMsg = "Local Raw Files:    Checked: %d, Found: %d, Moved: %d, Copied: %d"
 	logger.Info(
-		fmt.Sprintf(logMsg, s.LocalRawFilesChecked, s.LocalRawFilesFound, s.LocalRawFilesMoved, s.LocalRawFilesCopied),
+		fmt.Sprintf(logMsg, s.Counter(LocalRawFilesChecked), s.Counter(LocalRawFilesFound), s.Counter(LocalRawFilesMoved), s.Counter(LocalRawFilesCopied)),
 	)
 
 	logMsg = "Local Edited Files: Checked: %d, Found: %d, Moved: %d, Copied: %d"
 	logger.Info(
-		fmt.Sprintf(logMsg, s.LocalEditedFilesChecked, s.LocalEditedFilesFound, s.LocalEditedFilesMoved, s.LocalEditedFilesCopied),
+		fmt.Sprintf(logMsg, s.Counter(LocalEditedFilesChecked), s.Counter(LocalEditedFilesFound), s.Counter(LocalEditedFilesMoved), s.Counter(LocalEditedFilesCopied)),
 	)
 
 	logMsg = "To Upload Files:    Checked: %d, Found: %d, Uploaded: %d"
 	logger.Info(
-		fmt.Sprintf(logMsg, s.ToUploadFilesChecked, s.ToUploadFilesFound, s.ToUploadFilesUploaded),
+		fmt.Sprintf(logMsg, s.Counter(ToUploadFilesChecked), s.Counter(ToUploadFilesFound), s.Counter(ToUploadFilesUploaded)),
+	)
+
+	logMsg = "Duplicate Files:    Skipped: %d, Linked: %d"
+	logger.Info(
+		fmt.Sprintf(logMsg, s.Counter(DuplicatesSkipped), s.Counter(DuplicatesLinked)),
 	)
 
-	totalFilesChecked := s.RawFilesChecked + s.LocalRawFilesChecked + s.LocalEditedFilesChecked + s.ToUploadFilesChecked
-	totalFilesFound := s.RawFilesFound + s.LocalRawFilesFound + s.LocalEditedFilesFound + s.ToUploadFilesFound
-	totalFilesProcessed := s.RawFilesImported + s.LocalRawFilesMoved + s.LocalRawFilesCopied + s.LocalEditedFilesMoved + s.LocalEditedFilesCopied + s.ToUploadFilesUploaded
+	totalFilesChecked := s.Counter(RawFilesChecked) + s.Counter(LocalRawFilesChecked) + s.Counter(LocalEditedFilesChecked) + s.Counter(ToUploadFilesChecked)
+	totalFilesFound := s.Counter(RawFilesFound) + s.Counter(LocalRawFilesFound) + s.Counter(LocalEditedFilesFound) + s.Counter(ToUploadFilesFound)
+	totalFilesProcessed := s.Counter(RawFilesImported) + s.Counter(LocalRawFilesMoved) + s.Counter(LocalRawFilesCopied) + s.Counter(LocalEditedFilesMoved) + s.Counter(LocalEditedFilesCopied) + s.Counter(ToUploadFilesUploaded)
+
+	logMsg = "Undated Files:      Quarantined: %d"
+	logger.Info(
+		fmt.Sprintf(logMsg, s.Counter(FilesQuarantined)),
+	)
+
+	logMsg = "Filtered Files:     Excluded: %d"
+	logger.Info(
+		fmt.Sprintf(logMsg, s.Counter(FilesExcluded)),
+	)
 
-	logMsg = "Totals:             Checked: %d, Found: %d, Processed: %d"
+	logMsg = "Totals:             Checked: %d, Found: %d, Processed: %d, Checksum Errors: %d, Failed: %d"
 	logger.Info(
-		fmt.Sprintf(logMsg, totalFilesChecked, totalFilesFound, totalFilesProcessed),
+		fmt.Sprintf(logMsg, totalFilesChecked, totalFilesFound, totalFilesProcessed, s.Counter(ChecksumErrors), s.Counter(FilesFailed)),
 	)
 }
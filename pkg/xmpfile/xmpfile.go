@@ -0,0 +1,102 @@
+package xmpfile
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evanoberholster/imagemeta/xmp"
+)
+
+// maxEmbeddedScan bounds how much of a file is searched for embedded XMP.
+const maxEmbeddedScan = 512 * 1024
+
+// sidecars returns the paths an editor may write the file's XMP sidecar to,
+// IMG_0001.CR2.xmp or IMG_0001.xmp in either case, in the order they are read.
+func sidecars(path string) []string {
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	return []string{path + ".xmp", path + ".XMP", stem + ".xmp", stem + ".XMP"}
+}
+
+// Packet is a parsed XMP packet.
+type Packet struct {
+	xmp.XMP
+	data []byte
+}
+
+// Value returns the value the packet sets for the property, given by its
+// namespace URI and name, as an attribute or an element, and whether it sets
+// it at all. The parsed XMP cannot tell an unset property from one set to its
+// zero value.
+func (p Packet) Value(namespace, name string) (string, bool) {
+	decoder := xml.NewDecoder(bytes.NewReader(p.data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", false
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Space == namespace && attr.Name.Local == name {
+				return attr.Value, true
+			}
+		}
+		if start.Name.Space == namespace && start.Name.Local == name {
+			var value string
+			if err := decoder.DecodeElement(&value, &start); err != nil {
+				return "", false
+			}
+			return strings.TrimSpace(value), true
+		}
+	}
+}
+
+// Find calls accept with the XMP of each sidecar of the file that exists and
+// parses, then with the XMP embedded near the start of the file, until accept
+// returns true. It reports whether any XMP was accepted.
+func Find(path string, accept func(p Packet) bool) bool {
+	for _, sidecar := range sidecars(path) {
+		data, err := os.ReadFile(sidecar)
+		if err != nil {
+			continue
+		}
+		if p, ok := parse(data); ok && accept(p) {
+			return true
+		}
+	}
+
+	p, ok := embedded(path)
+	return ok && accept(p)
+}
+
+// embedded returns the XMP packet in the first maxEmbeddedScan bytes of the file.
+func embedded(path string) (Packet, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Packet{}, false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxEmbeddedScan))
+	if err != nil {
+		return Packet{}, false
+	}
+	start := bytes.Index(data, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return Packet{}, false
+	}
+	return parse(data[start:])
+}
+
+func parse(data []byte) (Packet, bool) {
+	x, err := xmp.ParseXmp(bytes.NewReader(data))
+	if err != nil {
+		return Packet{}, false
+	}
+	return Packet{XMP: x, data: data}, true
+}